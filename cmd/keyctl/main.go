@@ -0,0 +1,194 @@
+// keyctl 管理API密钥：默认通过运行中服务器的管理接口操作，指定 -store 时直接修改密钥存储文件（仅在服务器停止时使用）
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gay/plugintools/internal/auth"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: keyctl [flags] <command> [args]
+
+Commands:
+  list                                   list keys
+  create -name NAME [-principal P] [-scopes a,b] [-expires 720h]
+  rotate [-grace 24h] [-expires 720h] ID  issue a replacement key
+  revoke ID                              revoke a key
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "Tool server address")
+	apiKey := flag.String("api-key", os.Getenv("PLUGINTOOLS_API_KEY"), "Admin API key (needs the admin:keys permission)")
+	storePath := flag.String("store", "", "Edit the key store file directly instead of calling the server")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var client keyClient
+	if *storePath != "" {
+		store, err := auth.OpenKeyStore(*storePath)
+		if err != nil {
+			fatal(err)
+		}
+		client = storeClient{store}
+	} else {
+		client = httpClient{server: strings.TrimRight(*server, "/"), apiKey: *apiKey}
+	}
+
+	result, err := run(client, flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+}
+
+// run 解析子命令参数并执行
+func run(client keyClient, command string, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	name := fs.String("name", "", "Key name")
+	principal := fs.String("principal", "", "Principal the key acts as")
+	scopes := fs.String("scopes", "", "Comma separated tool:operation scopes")
+	expires := fs.Duration("expires", 0, "Key lifetime, e.g. 720h")
+	grace := fs.Duration("grace", 0, "How long the old key stays valid after rotation")
+	fs.Parse(args)
+
+	req := map[string]interface{}{}
+	if *expires > 0 {
+		req["expires_in"] = int(expires.Seconds())
+	}
+
+	switch command {
+	case "list":
+		return client.do(http.MethodGet, "", nil)
+	case "create":
+		req["name"] = *name
+		req["principal"] = *principal
+		if *scopes != "" {
+			req["scopes"] = strings.Split(*scopes, ",")
+		}
+		return client.do(http.MethodPost, "", req)
+	case "rotate":
+		if fs.NArg() != 1 {
+			return nil, fmt.Errorf("rotate requires a key ID")
+		}
+		req["grace_period"] = int(grace.Seconds())
+		return client.do(http.MethodPost, fs.Arg(0)+"/rotate", req)
+	case "revoke":
+		if fs.NArg() != 1 {
+			return nil, fmt.Errorf("revoke requires a key ID")
+		}
+		return client.do(http.MethodDelete, fs.Arg(0), nil)
+	default:
+		return nil, fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+// keyClient 执行密钥管理请求，path为 /api/v1/admin/keys 之后的部分
+type keyClient interface {
+	do(method, path string, req map[string]interface{}) (interface{}, error)
+}
+
+// httpClient 调用服务器的管理接口
+type httpClient struct {
+	server string
+	apiKey string
+}
+
+func (c httpClient) do(method, path string, req map[string]interface{}) (interface{}, error) {
+	var body io.Reader
+	if req != nil {
+		data, _ := json.Marshal(req)
+		body = bytes.NewReader(data)
+	}
+	url := c.server + "/api/v1/admin/keys"
+	if path != "" {
+		url += "/" + path
+	}
+	httpReq, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// storeClient 直接修改密钥存储文件
+type storeClient struct {
+	store *auth.KeyStore
+}
+
+func (c storeClient) do(method, path string, req map[string]interface{}) (interface{}, error) {
+	var expiresAt *time.Time
+	if seconds, ok := req["expires_in"].(int); ok {
+		t := time.Now().UTC().Add(time.Duration(seconds) * time.Second)
+		expiresAt = &t
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	switch {
+	case method == http.MethodGet:
+		return c.store.List(), nil
+	case method == http.MethodPost && id == "":
+		scopes, _ := req["scopes"].([]string)
+		key, secret, err := c.store.Create(auth.KeyOptions{
+			Name:      req["name"].(string),
+			Principal: req["principal"].(string),
+			Scopes:    scopes,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "api_key": secret}, nil
+	case method == http.MethodPost && action == "rotate":
+		grace := time.Duration(req["grace_period"].(int)) * time.Second
+		key, secret, err := c.store.Rotate(id, grace, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "api_key": secret}, nil
+	default:
+		return c.store.Revoke(id)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "keyctl:", err)
+	os.Exit(1)
+}
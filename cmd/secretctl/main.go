@@ -0,0 +1,111 @@
+// secretctl 管理加密密钥文件（secrets.encrypted_file），服务器启动时读取该文件，修改后需重启服务器
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gay/plugintools/internal/secrets"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: secretctl [flags] <command> [args]
+
+Commands:
+  genkey              print a new base64 master key
+  list                list secret names and update times
+  set NAME [VALUE]    store a secret, reads the value from stdin when omitted
+  get NAME            print a secret
+  delete NAME         delete a secret
+
+The master key is read from -key-file or the %s environment variable.
+
+Flags:
+`, secrets.KeyEnv)
+	flag.PrintDefaults()
+}
+
+func main() {
+	file := flag.String("file", "secrets.enc.json", "Encrypted secrets file")
+	keyFile := flag.String("key-file", "", "File containing the base64 master key")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	if command == "genkey" {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	key, err := secrets.LoadKey(*keyFile)
+	if err != nil {
+		fatal(err)
+	}
+	store, err := secrets.OpenEncryptedFile(*file, key)
+	if err != nil {
+		fatal(err)
+	}
+	if err := run(store, command, args); err != nil {
+		fatal(err)
+	}
+}
+
+// run 执行子命令
+func run(store *secrets.EncryptedFileStore, command string, args []string) error {
+	switch command {
+	case "list":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(store.List())
+	case "set":
+		if len(args) != 1 && len(args) != 2 {
+			return fmt.Errorf("set requires a name and an optional value")
+		}
+		value := ""
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			// 从标准输入读取，避免密钥出现在shell历史和进程列表中
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("failed to read value from stdin: %v", err)
+			}
+			value = strings.TrimRight(line, "\r\n")
+		}
+		return store.Set(args[0], value)
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("get requires a name")
+		}
+		value, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("delete requires a name")
+		}
+		return store.Delete(args[0])
+	default:
+		return fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "secretctl:", err)
+	os.Exit(1)
+}
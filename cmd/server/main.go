@@ -4,14 +4,27 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"gay/plugintools/internal/audit"
+	"gay/plugintools/internal/auth"
 	"gay/plugintools/internal/config"
 	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+	"gay/plugintools/internal/sandbox"
+	"gay/plugintools/internal/secrets"
 	"gay/plugintools/internal/server"
 	"gay/plugintools/internal/tools"
 )
 
 func main() {
+	// 沙箱初始化进程：应用限制后exec目标命令，不会返回
+	if sandbox.IsInitProcess() {
+		sandbox.RunInitProcess()
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "configs/config.json", "Path to configuration file")
 	flag.Parse()
@@ -22,31 +35,142 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// 日志输出前隐藏已读取的密钥值
+	log.SetOutput(secrets.RedactWriter(os.Stderr))
+
+	// 加载密钥存储并替换配置中的 ${secret:name} 引用
+	store, err := openSecretStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+	if store != nil {
+		secrets.SetDefault(store)
+	}
+	if err := secrets.ResolveConfig(cfg); err != nil {
+		log.Fatalf("Failed to resolve secrets in configuration: %v", err)
+	}
+
+	// 校验受信任的JWT颁发者，未配置audience等必需项时拒绝启动
+	if err := auth.CheckIssuers(cfg.Security.JWT.Issuers); err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+
+	// 加载哈希API密钥存储
+	if cfg.Security.KeyStore != "" {
+		keys, err := auth.OpenKeyStore(cfg.Security.KeyStore)
+		if err != nil {
+			log.Fatalf("Failed to open key store: %v", err)
+		}
+		auth.SetKeyStore(keys)
+	}
+
+	// 编译工具调用策略，策略无效时拒绝启动
+	if cfg.Policies.Enabled {
+		engine, err := policy.Compile(cfg)
+		if err != nil {
+			log.Fatalf("Failed to compile policies: %v", err)
+		}
+		policy.SetDefault(engine)
+	}
+
 	// Create tool registry
 	registry := core.NewRegistry()
 
 	// Register tools
-	if err := registerTools(registry); err != nil {
+	fileManager := tools.NewFileManager()
+	fileManager.SetRegistry(registry)
+	defer fileManager.Close()
+
+	shellExecutor := tools.NewShellExecutor()
+	defer shellExecutor.Close()
+	if store != nil {
+		shellExecutor.SetSecretStore(store)
+	}
+	if cfg.Tools.ShellExecutor.History.File != "" {
+		if err := shellExecutor.OpenHistory(cfg.Tools.ShellExecutor.History.File); err != nil {
+			log.Fatalf("Failed to open shell history: %v", err)
+		}
+	}
+
+	if err := registerTools(registry, fileManager, shellExecutor); err != nil {
 		log.Fatalf("Failed to register tools: %v", err)
 	}
 
 	// Create and start server
 	srv := server.NewServer(registry)
+	fileManager.SetLimiter(srv)
+	if cfg.Audit.Enabled {
+		auditLog, err := audit.Open(cfg.Audit.File)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		srv.SetAuditLog(auditLog)
+	}
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	log.Printf("Starting server on %s", addr)
-	if err := srv.Start(addr); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	go func() {
+		if err := srv.Start(addr); err != nil {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// 收到退出信号后返回，由defer结束后台进程、交互会话和文件监听
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	log.Printf("Received %s, shutting down", sig)
+}
+
+// openSecretStore 按加密文件、明文文件、环境变量的顺序组合配置的密钥存储，未配置时返回nil
+func openSecretStore(cfg *config.Config) (secrets.Store, error) {
+	var chain secrets.Chain
+	if cfg.Secrets.EncryptedFile != "" {
+		key, err := secrets.LoadKey(cfg.Secrets.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		store, err := secrets.OpenEncryptedFile(cfg.Secrets.EncryptedFile, key)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, store)
+	}
+	if cfg.Secrets.File != "" {
+		store, err := secrets.NewFileStore(cfg.Secrets.File)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, store)
+	}
+	if cfg.Secrets.Env.Enabled {
+		store, err := secrets.NewEnvStore(cfg.Secrets.Env.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, store)
 	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
 }
 
 // registerTools 注册所有工具
-func registerTools(registry core.ToolRegistry) error {
+func registerTools(registry core.ToolRegistry, fileManager *tools.FileManager, shellExecutor *tools.ShellExecutor) error {
 	tools := []core.Tool{
-		tools.NewFileManager(),
-		tools.NewShellExecutor(),
+		fileManager,
+		shellExecutor,
 		tools.NewScheduler(),
 	}
 
+	// 设置了register的命令模板作为独立工具注册
+	templateTools, err := shellExecutor.TemplateTools()
+	if err != nil {
+		return err
+	}
+	tools = append(tools, templateTools...)
+
 	for _, tool := range tools {
 		if err := registry.Register(tool); err != nil {
 			return err
@@ -1,3 +1,15 @@
 module gay/plugintools
 
-go 1.21 
\ No newline at end of file
+go 1.22
+
+require (
+	github.com/creack/pty v1.1.24
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
+	github.com/zeebo/blake3 v0.2.4
+	golang.org/x/sys v0.13.0
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.12 // indirect
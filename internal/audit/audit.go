@@ -0,0 +1,655 @@
+// Package audit 以哈希链的JSON Lines文件记录工具调用，任何条目被修改、删除或插入都会使链校验失败
+//
+// 配置了密钥时条目哈希为HMAC，没有密钥无法重新计算被篡改后的链；配置了锚点文件时
+// 每次写入后记录最后一条记录的序号和哈希，尾部记录被删除后重启也能被校验发现。
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/secrets"
+)
+
+const (
+	// defaultMaxParamSize 未配置时参数中字符串值保留的最大长度
+	defaultMaxParamSize = 256
+	// defaultQueryLimit 查询时默认返回的条数
+	defaultQueryLimit = 100
+	// rotatedTimeFormat 轮换文件名中的时间格式
+	rotatedTimeFormat = "20060102T150405.000000000"
+	// maxEntrySize 单条记录的最大字节数
+	maxEntrySize = 16 * 1024 * 1024
+	// reverseChunkSize 从文件末尾向前读取时每次读取的字节数
+	reverseChunkSize = 64 * 1024
+)
+
+// defaultRedactParams 总是隐藏值的参数名
+var defaultRedactParams = []string{"stdin", "env", "secrets", "script", "password", "token", "api_key", "content"}
+
+// Entry 一条审计记录
+type Entry struct {
+	Seq        int64                  `json:"seq"`
+	Time       time.Time              `json:"time"`
+	Caller     string                 `json:"caller,omitempty"`
+	RemoteAddr string                 `json:"remote_addr,omitempty"`
+	ToolID     string                 `json:"tool_id"`
+	Operation  string                 `json:"operation,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Success    bool                   `json:"success"`
+	ErrorCode  int                    `json:"error_code,omitempty"` // HTTP状态码
+	Error      string                 `json:"error,omitempty"`
+	Result     map[string]interface{} `json:"result,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+	ApprovalID string                 `json:"approval_id,omitempty"` // 经审批执行时的审批请求ID
+	ApprovedBy string                 `json:"approved_by,omitempty"`
+	PrevHash   string                 `json:"prev_hash"`
+	Hash       string                 `json:"hash"`
+}
+
+// computeHash 计算条目的哈希，覆盖除hash以外的所有字段，key非空时使用HMAC-SHA256
+func (e *Entry) computeHash(key []byte) string {
+	copied := *e
+	copied.Hash = ""
+	data, _ := json.Marshal(copied)
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// anchor 锚点文件内容，记录最后写入的记录
+type anchor struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Log 审计日志，超过大小上限时轮换文件，哈希链跨文件延续
+type Log struct {
+	path string
+	key  []byte
+
+	mu       sync.Mutex
+	file     *os.File
+	anchor   *os.File
+	size     int64
+	seq      int64
+	lastHash string
+}
+
+// Open 打开审计日志，从已有文件的最后一条记录继续哈希链
+// 锚点记录的位置在日志末尾之后时说明尾部记录被删除，从锚点继续哈希链，使校验能够发现缺失的记录
+func Open(path string) (*Log, error) {
+	cfg := config.Get().Audit
+	if cfg.AnchorFile != "" && isLogFile(path, cfg.AnchorFile) {
+		return nil, fmt.Errorf("audit anchor_file %s must not be the audit log or match %s.*", cfg.AnchorFile, path)
+	}
+	l := &Log{path: path, key: []byte(cfg.Key)}
+	files, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0 && l.lastHash == ""; i-- {
+		last, err := lastEntry(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq, l.lastHash = last.Seq, last.Hash
+		}
+	}
+
+	if cfg.AnchorFile != "" {
+		if err := l.openAnchor(cfg.AnchorFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.openFile(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	// 服务器日志中的链位置也可作为外部锚点
+	log.Printf("audit: chain continues after seq %d (hash %s)", l.seq, l.lastHash)
+	return l, nil
+}
+
+// isLogFile 判断文件是否为审计日志或其轮换文件，轮换、清理和校验按 path.* 查找轮换文件
+func isLogFile(path, name string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	if absName == absPath {
+		return true
+	}
+	matched, _ := filepath.Match(absPath+".*", absName)
+	return matched
+}
+
+// openAnchor 打开锚点文件，并与日志中的最后一条记录比对
+func (l *Log) openAnchor(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit anchor: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read audit anchor: %v", err)
+	}
+	l.anchor = f
+
+	var a anchor
+	if len(bytes.TrimSpace(data)) == 0 || json.Unmarshal(data, &a) != nil {
+		return nil
+	}
+	// 写入记录后才更新锚点，锚点落后一条是正常的崩溃结果
+	if a.Seq > l.seq || (a.Seq == l.seq && a.Hash != l.lastHash) {
+		log.Printf("audit: log ends at seq %d but anchor records seq %d, entries were removed", l.seq, a.Seq)
+		l.seq, l.lastHash = a.Seq, a.Hash
+	}
+	return nil
+}
+
+// writeAnchor 将最后一条记录的序号和哈希写入锚点文件，调用方需持有锁
+func (l *Log) writeAnchor() error {
+	if l.anchor == nil {
+		return nil
+	}
+	data, _ := json.Marshal(anchor{Seq: l.seq, Hash: l.lastHash})
+	if err := l.anchor.Truncate(0); err != nil {
+		return fmt.Errorf("failed to update audit anchor: %v", err)
+	}
+	if _, err := l.anchor.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to update audit anchor: %v", err)
+	}
+	return nil
+}
+
+// openFile 以追加方式打开当前文件，调用方需持有锁或在初始化时调用
+func (l *Log) openFile() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// Record 追加一条记录，填充序号、时间和哈希，并隐藏敏感参数
+func (l *Log) Record(entry Entry) error {
+	entry.Params = Sanitize(entry.Params)
+	entry.Error = secrets.Redact(entry.Error)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	if maxSize := config.Get().Audit.MaxSize; maxSize > 0 && l.size >= maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	entry.Seq = l.seq + 1
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.PrevHash = l.lastHash
+	entry.Hash = entry.computeHash(l.key)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(data, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+	return l.writeAnchor()
+}
+
+// rotate 将当前文件改名为带时间戳的文件并打开新文件，然后按保留策略删除旧文件
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %v", err)
+	}
+	l.file = nil
+	rotated := l.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(l.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %v", err)
+	}
+	if err := l.openFile(); err != nil {
+		return err
+	}
+	l.prune()
+	return nil
+}
+
+// prune 删除超过保留数量或保留天数的轮换文件
+func (l *Log) prune() {
+	cfg := config.Get().Audit
+	rotated, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Strings(rotated)
+	for i, path := range rotated {
+		expired := cfg.MaxAge > 0 && fileOlderThan(path, time.Duration(cfg.MaxAge)*24*time.Hour)
+		excess := cfg.MaxFiles > 0 && i < len(rotated)-cfg.MaxFiles
+		if expired || excess {
+			os.Remove(path)
+		}
+	}
+}
+
+// fileOlderThan 检查文件的修改时间是否早于指定时长之前
+func fileOlderThan(path string, age time.Duration) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > age
+}
+
+// files 返回按时间排序的所有审计文件，当前文件在最后
+func (l *Log) files() ([]string, error) {
+	rotated, err := filepath.Glob(l.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+	if _, err := os.Stat(l.path); err == nil {
+		rotated = append(rotated, l.path)
+	}
+	return rotated, nil
+}
+
+// lastEntry 读取文件中的最后一条记录，文件为空时返回nil
+func lastEntry(path string) (*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	var last *Entry
+	err = scanReverse(f, info.Size(), func(line []byte) (bool, error) {
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return false, fmt.Errorf("%s: invalid audit entry: %v", path, err)
+		}
+		last = &entry
+		return false, nil
+	})
+	return last, err
+}
+
+// auditFile 读取快照中的一个文件
+type auditFile struct {
+	path string
+	file *os.File
+	size int64 // 打开时的文件大小，之后追加的记录不在快照中
+}
+
+// snapshot 在锁内打开所有审计文件并记录链的末尾，之后在锁外读取，不阻塞写入
+// 已打开的文件在轮换改名或被保留策略删除后仍可读取
+type snapshot struct {
+	files    []auditFile
+	seq      int64
+	lastHash string
+}
+
+func (l *Log) snapshot() (*snapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{seq: l.seq, lastHash: l.lastHash}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			snap.close()
+			return nil, fmt.Errorf("failed to read audit log: %v", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			snap.close()
+			return nil, fmt.Errorf("failed to read audit log: %v", err)
+		}
+		snap.files = append(snap.files, auditFile{path: path, file: f, size: info.Size()})
+	}
+	return snap, nil
+}
+
+func (s *snapshot) close() {
+	for _, f := range s.files {
+		f.file.Close()
+	}
+}
+
+// scanForward 从头逐行读取r的前size字节，fn返回false时停止
+func scanForward(r io.ReaderAt, size int64, fn func(line []byte) (bool, error)) error {
+	scanner := bufio.NewScanner(io.NewSectionReader(r, 0, size))
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		more, err := fn(scanner.Bytes())
+		if err != nil || !more {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return nil
+}
+
+// scanReverse 从末尾向前逐行读取r的前size字节，fn返回false时停止
+func scanReverse(r io.ReaderAt, size int64, fn func(line []byte) (bool, error)) error {
+	var tail []byte // 尚未遇到行首的部分
+	for end := size; end > 0; {
+		start := max(0, end-reverseChunkSize)
+		buf := make([]byte, end-start, end-start+int64(len(tail)))
+		if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read audit log: %v", err)
+		}
+		data := append(buf, tail...)
+		for {
+			i := bytes.LastIndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if line := data[i+1:]; len(line) > 0 {
+				if more, err := fn(line); err != nil || !more {
+					return err
+				}
+			}
+			data = data[:i]
+		}
+		if len(data) > maxEntrySize {
+			return fmt.Errorf("failed to read audit log: entry exceeds %d bytes", maxEntrySize)
+		}
+		tail = data
+		end = start
+	}
+	if len(tail) > 0 {
+		_, err := fn(tail)
+		return err
+	}
+	return nil
+}
+
+// Filter 查询条件
+type Filter struct {
+	Caller    string
+	ToolID    string
+	Operation string
+	Failed    bool // 只返回失败的记录
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// match 检查记录是否满足查询条件
+func (filter Filter) match(e *Entry) bool {
+	switch {
+	case filter.Caller != "" && e.Caller != filter.Caller,
+		filter.ToolID != "" && e.ToolID != filter.ToolID,
+		filter.Operation != "" && e.Operation != filter.Operation,
+		filter.Failed && e.Success,
+		!filter.Since.IsZero() && e.Time.Before(filter.Since),
+		!filter.Until.IsZero() && e.Time.After(filter.Until):
+		return false
+	}
+	return true
+}
+
+// Query 按条件查询记录，最新的在前
+// 从最新的文件末尾向前读取，找到足够的记录即停止，不阻塞写入
+func (l *Log) Query(filter Filter) ([]*Entry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	snap, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.close()
+
+	result := []*Entry{}
+	done := false
+	for i := len(snap.files) - 1; i >= 0 && len(result) < limit && !done; i-- {
+		f := snap.files[i]
+		err := scanReverse(f.file, f.size, func(line []byte) (bool, error) {
+			var e Entry
+			if err := json.Unmarshal(line, &e); err != nil {
+				return false, fmt.Errorf("%s: invalid audit entry: %v", f.path, err)
+			}
+			// 早于since的记录之前只有更早的记录
+			if !filter.Since.IsZero() && e.Time.Before(filter.Since) {
+				done = true
+				return false, nil
+			}
+			if filter.match(&e) {
+				result = append(result, &e)
+			}
+			return len(result) < limit, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// VerifyResult 哈希链校验结果
+type VerifyResult struct {
+	Valid   bool   `json:"valid"`
+	Entries int64  `json:"entries"`
+	Files   int    `json:"files"`
+	Error   string `json:"error,omitempty"`
+	File    string `json:"file,omitempty"`
+	Seq     int64  `json:"seq,omitempty"`
+}
+
+// Verify 逐条读取并校验所有保留文件中的哈希链，不阻塞写入
+// 被保留策略删除的文件之后的第一条记录无法与前一条比对，从该条记录开始校验；
+// 最后一条记录须与写入时（配置了锚点时包括重启前）记录的链末尾一致，否则说明尾部记录被删除
+func (l *Log) Verify() (*VerifyResult, error) {
+	snap, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.close()
+
+	result := &VerifyResult{Valid: true, Files: len(snap.files)}
+	var prev *Entry
+	for _, f := range snap.files {
+		fail := func(msg string, seq int64) *VerifyResult {
+			return &VerifyResult{Entries: result.Entries, Files: len(snap.files), Error: msg, File: f.path, Seq: seq}
+		}
+		var failed *VerifyResult
+		err := scanForward(f.file, f.size, func(line []byte) (bool, error) {
+			e := &Entry{}
+			if err := json.Unmarshal(line, e); err != nil {
+				failed = fail(fmt.Sprintf("invalid audit entry: %v", err), 0)
+				return false, nil
+			}
+			if e.computeHash(l.key) != e.Hash {
+				failed = fail("entry hash mismatch", e.Seq)
+				return false, nil
+			}
+			if prev != nil {
+				if e.PrevHash != prev.Hash {
+					failed = fail("chain broken: prev_hash does not match the previous entry", e.Seq)
+					return false, nil
+				}
+				if e.Seq != prev.Seq+1 {
+					failed = fail(fmt.Sprintf("sequence gap: expected %d", prev.Seq+1), e.Seq)
+					return false, nil
+				}
+			}
+			prev = e
+			result.Entries++
+			return true, nil
+		})
+		if err != nil {
+			return fail(err.Error(), 0), nil
+		}
+		if failed != nil {
+			return failed, nil
+		}
+	}
+	if prev != nil && prev.Hash != snap.lastHash {
+		return &VerifyResult{Entries: result.Entries, Files: len(snap.files), Error: fmt.Sprintf("last entry does not match the chain end at seq %d, entries were removed", snap.seq), Seq: prev.Seq}, nil
+	}
+	return result, nil
+}
+
+// Close 关闭审计日志
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.anchor != nil {
+		l.anchor.Close()
+		l.anchor = nil
+	}
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Sanitize 隐藏敏感参数并截断过长的字符串
+func Sanitize(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+	cfg := config.Get().Audit
+	maxSize := cfg.MaxParamSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxParamSize
+	}
+	redact := make(map[string]bool)
+	for _, name := range append(defaultRedactParams, cfg.RedactParams...) {
+		redact[strings.ToLower(name)] = true
+	}
+	return sanitizeMap(params, redact, maxSize)
+}
+
+func sanitizeMap(m map[string]interface{}, redact map[string]bool, maxSize int) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if redact[strings.ToLower(k)] {
+			result[k] = "[REDACTED]"
+			continue
+		}
+		result[k] = sanitizeValue(v, redact, maxSize)
+	}
+	return result
+}
+
+func sanitizeValue(v interface{}, redact map[string]bool, maxSize int) interface{} {
+	switch val := v.(type) {
+	case string:
+		val = secrets.Redact(val)
+		if len(val) > maxSize {
+			return strings.ToValidUTF8(val[:maxSize], "") + fmt.Sprintf("...[%d bytes]", len(val))
+		}
+		return val
+	case map[string]interface{}:
+		return sanitizeMap(val, redact, maxSize)
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			result[i] = sanitizeValue(item, redact, maxSize)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// Summarize 生成结果摘要：只保留结果中的标量字段，集合只记录长度
+func Summarize(result interface{}) map[string]interface{} {
+	switch val := result.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		summary := make(map[string]interface{})
+		for k, v := range val {
+			switch item := v.(type) {
+			case bool, float64, int, int64:
+				summary[k] = item
+			case string:
+				// 标识和状态原样保留，其他字符串（如命令输出）可能包含敏感内容，只记录长度
+				if k == "id" || k == "status" || strings.HasSuffix(k, "_id") {
+					summary[k] = item
+				} else {
+					summary[k+"_bytes"] = len(item)
+				}
+			}
+		}
+		return summary
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return map[string]interface{}{"type": fmt.Sprintf("%T", val)}
+		}
+		var decoded interface{}
+		json.Unmarshal(data, &decoded)
+		switch d := decoded.(type) {
+		case map[string]interface{}:
+			return Summarize(d)
+		case []interface{}:
+			return map[string]interface{}{"items": len(d)}
+		default:
+			return map[string]interface{}{"value": d}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gay/plugintools/internal/config"
+)
+
+// loadAuditConfig 加载带HMAC密钥的审计配置，anchor非空时配置锚点文件
+// 配置只加载一次，之后的调用直接修改已加载配置中的锚点文件
+func loadAuditConfig(t *testing.T, anchor string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"audit": {"enabled": true, "key": "test-audit-key"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Audit.AnchorFile = anchor
+}
+
+// writeEntries 写入n条记录并关闭日志
+func writeEntries(t *testing.T, path string, n int) {
+	t.Helper()
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := l.Record(Entry{ToolID: "file-manager", Operation: "read", Success: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+}
+
+// rewriteLines 按行修改日志文件
+func rewriteLines(t *testing.T, path string, edit func(lines []string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		out += "\n"
+	}
+	if err := os.WriteFile(path, []byte(out), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		anchor  bool
+		edit    func(lines []string) []string
+		wantErr string
+		wantSeq int64
+	}{
+		{name: "intact", edit: func(lines []string) []string { return lines }},
+		{
+			name: "edited entry",
+			edit: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"operation":"read"`, `"operation":"list"`, 1)
+				return lines
+			},
+			wantErr: "entry hash mismatch",
+			wantSeq: 2,
+		},
+		{
+			name: "edited entry rehashed without the key",
+			edit: func(lines []string) []string {
+				var e Entry
+				json.Unmarshal([]byte(lines[1]), &e)
+				e.Operation = "list"
+				e.Hash = ""
+				data, _ := json.Marshal(e)
+				sum := sha256.Sum256(data)
+				e.Hash = hex.EncodeToString(sum[:])
+				data, _ = json.Marshal(e)
+				lines[1] = string(data)
+				return lines
+			},
+			wantErr: "entry hash mismatch",
+			wantSeq: 2,
+		},
+		{
+			name:    "dropped entry",
+			edit:    func(lines []string) []string { return append(lines[:1:1], lines[2:]...) },
+			wantErr: "chain broken",
+			wantSeq: 3,
+		},
+		{
+			name: "reordered entries",
+			edit: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantErr: "chain broken",
+			wantSeq: 3,
+		},
+		{
+			name: "invalid line",
+			edit: func(lines []string) []string {
+				lines[1] = "not json"
+				return lines
+			},
+			wantErr: "invalid audit entry",
+		},
+		{
+			name:    "truncated tail with anchor",
+			anchor:  true,
+			edit:    func(lines []string) []string { return lines[:2] },
+			wantErr: "entries were removed",
+			wantSeq: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			anchor := ""
+			if tt.anchor {
+				anchor = filepath.Join(t.TempDir(), "anchor.json")
+			}
+			loadAuditConfig(t, anchor)
+			path := filepath.Join(dir, "audit.log")
+			writeEntries(t, path, 4)
+			rewriteLines(t, path, tt.edit)
+
+			l, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			result, err := l.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr == "" {
+				if !result.Valid {
+					t.Fatalf("expected valid log, got %+v", result)
+				}
+				return
+			}
+			if result.Valid || !strings.Contains(result.Error, tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %+v", tt.wantErr, result)
+			}
+			if tt.wantSeq != 0 && result.Seq != tt.wantSeq {
+				t.Fatalf("seq = %d, want %d", result.Seq, tt.wantSeq)
+			}
+		})
+	}
+}
+
+func TestVerifyDetectsTruncationWhileOpen(t *testing.T) {
+	loadAuditConfig(t, "")
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < 3; i++ {
+		if err := l.Record(Entry{ToolID: "shell-executor", Operation: "run"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rewriteLines(t, path, func(lines []string) []string { return lines[:2] })
+
+	result, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || !strings.Contains(result.Error, "entries were removed") {
+		t.Fatalf("expected truncation to be detected, got %+v", result)
+	}
+}
+
+func TestVerifyContinuesChainAfterAnchoredTruncation(t *testing.T) {
+	anchor := filepath.Join(t.TempDir(), "anchor.json")
+	loadAuditConfig(t, anchor)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, path, 3)
+	rewriteLines(t, path, func(lines []string) []string { return lines[:1] })
+
+	// 重启后继续写入的记录接在锚点之后，被删除的记录表现为链断开
+	writeEntries(t, path, 1)
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	result, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || result.Seq != 4 {
+		t.Fatalf("expected chain break at seq 4, got %+v", result)
+	}
+}
+
+func TestOpenRejectsAnchorCollidingWithLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	tests := []struct {
+		anchor  string
+		wantErr bool
+	}{
+		{anchor: path, wantErr: true},
+		{anchor: path + ".anchor", wantErr: true},
+		{anchor: path + ".20260101T000000", wantErr: true},
+		{anchor: filepath.Join(dir, "audit.anchor")},
+		{anchor: filepath.Join(dir, "other", "audit.log.anchor")},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.anchor), func(t *testing.T) {
+			os.MkdirAll(filepath.Dir(tt.anchor), 0755)
+			loadAuditConfig(t, tt.anchor)
+			l, err := Open(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if l != nil {
+				l.Close()
+			}
+		})
+	}
+}
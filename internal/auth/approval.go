@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"path"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// RequiresApproval 检查以指定参数对工具的操作是否匹配审批规则，未启用审批时返回false
+func RequiresApproval(tool core.Tool, operation string, params map[string]interface{}) bool {
+	cfg := config.Get().Approvals
+	if !cfg.Enabled {
+		return false
+	}
+
+	var tags []string
+	if tagger, ok := tool.(core.OperationTagger); ok {
+		tags = tagger.OperationTags(operation, params)
+	}
+	toolID := tool.GetInfo().ID
+	for _, rule := range cfg.Rules {
+		if rule.Tool == "" && rule.Operation == "" && rule.Tag == "" {
+			continue
+		}
+		if rule.Tool != "" {
+			if ok, _ := path.Match(rule.Tool, toolID); !ok {
+				continue
+			}
+		}
+		if rule.Operation != "" {
+			if ok, _ := path.Match(rule.Operation, operation); !ok {
+				continue
+			}
+		}
+		if rule.Tag != "" && !contains(tags, rule.Tag) {
+			continue
+		}
+		return true
+	}
+	return false
+}
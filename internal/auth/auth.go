@@ -0,0 +1,185 @@
+// Package auth 将API密钥解析为调用方，并按角色授予的工具操作进行授权
+//
+// 授权规则的格式为 "tool-id:operation"，两部分都支持通配符（如 "file-manager:*"、"*"），
+// 省略operation等同于 "tool-id:*"；以 "!" 开头的规则表示拒绝，优先于所有允许规则。
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// Authenticate 根据API密钥返回调用方，密钥无效时返回false
+// ptk_ 开头的密钥在密钥存储中校验；未分配给任何主体的 security.api_keys 密钥作为拥有全部权限的调用方，以兼容旧配置
+func Authenticate(apiKey string) (*core.Caller, bool) {
+	cfg := config.Get().Security
+
+	if store := Keys(); store != nil && strings.HasPrefix(apiKey, apiKeyPrefix) {
+		key, ok := store.Verify(apiKey)
+		if !ok {
+			return nil, false
+		}
+		return key.caller(), true
+	}
+
+	for name, principal := range cfg.Principals {
+		for _, key := range principal.APIKeys {
+			if keyEqual(apiKey, key) {
+				return newCaller(name, nil), true
+			}
+		}
+	}
+
+	for _, key := range cfg.APIKeys {
+		if keyEqual(apiKey, key) {
+			return &core.Caller{
+				ID:          KeyID(apiKey),
+				Permissions: cfg.Permissions[apiKey],
+				Grants:      []string{"*"},
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// AuthenticateCertificate 将已校验的客户端证书映射为调用方
+// server.tls.client_principals 的键可以是证书主题的完整DN（如 "CN=ci,O=Example"）或CN
+func AuthenticateCertificate(cert *x509.Certificate) (*core.Caller, bool) {
+	principals := config.Get().Server.TLS.ClientPrincipals
+	name, ok := principals[cert.Subject.String()]
+	if !ok && cert.Subject.CommonName != "" {
+		name, ok = principals[cert.Subject.CommonName]
+	}
+	if !ok {
+		return nil, false
+	}
+	return newCaller(name, nil), true
+}
+
+// newCaller 创建调用方，合并同名主体的配置、额外角色以及这些角色的授权规则和权限
+func newCaller(id string, extraRoles []string) *core.Caller {
+	cfg := config.Get().Security
+	principal := cfg.Principals[id]
+	caller := &core.Caller{
+		ID:          id,
+		Permissions: append([]string(nil), principal.Permissions...),
+	}
+	for _, roleName := range append(append([]string(nil), principal.Roles...), extraRoles...) {
+		role, ok := cfg.Roles[roleName]
+		if !ok || contains(caller.Roles, roleName) {
+			continue
+		}
+		caller.Roles = append(caller.Roles, roleName)
+		caller.Grants = append(caller.Grants, role.Grants...)
+		caller.Permissions = append(caller.Permissions, role.Permissions...)
+	}
+	return caller
+}
+
+// contains 检查字符串切片是否包含指定值
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// keyEqual 以固定时间比较API密钥
+func keyEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// KeyID 返回API密钥的指纹，用于在日志中标识调用方而不泄露密钥
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
+
+// Authorize 检查调用方是否可以对工具执行指定操作，caller为nil（未启用认证）时总是允许
+func Authorize(caller *core.Caller, toolID, operation string) bool {
+	if caller == nil {
+		return true
+	}
+	if len(caller.Scopes) > 0 && !allows(caller.Scopes, toolID, operation) {
+		return false
+	}
+	return allows(caller.Grants, toolID, operation)
+}
+
+// allows 检查授权规则列表是否允许对工具执行操作，拒绝规则优先
+func allows(grants []string, toolID, operation string) bool {
+	allowed := false
+	for _, grant := range grants {
+		deny := strings.HasPrefix(grant, "!")
+		if !matchGrant(strings.TrimPrefix(grant, "!"), toolID, operation) {
+			continue
+		}
+		if deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// CanSee 检查调用方是否有权使用工具的任一操作，用于工具列表和工具信息
+func CanSee(caller *core.Caller, toolID string) bool {
+	if caller == nil {
+		return true
+	}
+	if len(caller.Scopes) > 0 && !mentions(caller.Scopes, toolID) {
+		return false
+	}
+	return mentions(caller.Grants, toolID)
+}
+
+// mentions 检查授权规则列表中是否有允许规则匹配工具
+func mentions(grants []string, toolID string) bool {
+	for _, grant := range grants {
+		if strings.HasPrefix(grant, "!") {
+			continue
+		}
+		toolPattern, _, _ := strings.Cut(grant, ":")
+		if ok, _ := path.Match(toolPattern, toolID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGrant 检查授权规则是否匹配工具和操作
+func matchGrant(grant, toolID, operation string) bool {
+	toolPattern, opPattern, hasOp := strings.Cut(grant, ":")
+	if !hasOp {
+		opPattern = "*"
+	}
+	if ok, _ := path.Match(toolPattern, toolID); !ok {
+		return false
+	}
+	ok, _ := path.Match(opPattern, operation)
+	return ok
+}
+
+// Operation 返回一次调用的操作名：取params中的operation参数，缺省时使用工具声明的默认值
+func Operation(tool core.Tool, params map[string]interface{}) string {
+	if op, ok := params["operation"].(string); ok && op != "" {
+		return op
+	}
+	for _, spec := range tool.GetParams() {
+		if spec.Name == "operation" {
+			if op, ok := spec.Default.(string); ok {
+				return op
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+const (
+	// defaultMaxSkew 未配置时请求时间戳允许的偏差
+	defaultMaxSkew = 5 * time.Minute
+	// maxNonces 同时记录的nonce上限，超出时拒绝新请求，避免内存无限增长
+	maxNonces = 100000
+)
+
+// Signature 签名请求携带的认证信息
+type Signature struct {
+	ClientID  string // X-Client-Id
+	Timestamp string // X-Timestamp，Unix秒
+	Nonce     string // X-Nonce，每个请求唯一
+	Signature string // X-Signature，十六进制HMAC-SHA256
+}
+
+// nonceCache 记录时间窗口内已使用的nonce，用于拒绝重放的请求
+type nonceCache struct {
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	prunedAt time.Time
+}
+
+var nonces = &nonceCache{seen: make(map[string]time.Time)}
+
+// use 记录nonce，已使用过时返回错误
+func (c *nonceCache) use(key string, expires time.Time) error {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.prunedAt) > time.Minute || len(c.seen) >= maxNonces {
+		c.prunedAt = now
+		for k, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, k)
+			}
+		}
+	}
+	if exp, ok := c.seen[key]; ok && !now.After(exp) {
+		return fmt.Errorf("nonce has already been used")
+	}
+	if len(c.seen) >= maxNonces {
+		return fmt.Errorf("too many requests in the signature window")
+	}
+	c.seen[key] = expires
+	return nil
+}
+
+// StringToSign 返回需要签名的内容：方法、请求路径（含查询字符串）、时间戳、nonce和请求体SHA-256的十六进制，以换行分隔
+func StringToSign(method, requestURI, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), requestURI, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// Sign 使用密钥计算签名
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AuthenticateSignature 校验HMAC签名的请求并返回调用方
+// 时间戳必须在允许的偏差内，同一客户端的nonce在时间窗口内只能使用一次
+func AuthenticateSignature(sig Signature, method, requestURI string, body []byte) (*core.Caller, error) {
+	cfg := config.Get().Security.HMAC
+	client, ok := cfg.Clients[sig.ClientID]
+	if !ok || client.Secret == "" {
+		return nil, fmt.Errorf("unknown client: %s", sig.ClientID)
+	}
+	if sig.Nonce == "" || len(sig.Nonce) > 128 {
+		return nil, fmt.Errorf("nonce must be between 1 and 128 characters")
+	}
+
+	ts, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %s", sig.Timestamp)
+	}
+	skew := time.Duration(cfg.MaxSkew) * time.Second
+	if skew <= 0 {
+		skew = defaultMaxSkew
+	}
+	signedAt := time.Unix(ts, 0)
+	if d := time.Since(signedAt); d > skew || d < -skew {
+		return nil, fmt.Errorf("timestamp is outside the allowed clock skew of %s", skew)
+	}
+
+	expected := Sign(client.Secret, StringToSign(method, requestURI, sig.Timestamp, sig.Nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig.Signature))) {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	// 签名通过后才记录nonce；时间戳超出窗口的请求已被拒绝，因此nonce只需保留到窗口结束
+	if err := nonces.use(sig.ClientID+"\x00"+sig.Nonce, signedAt.Add(skew)); err != nil {
+		return nil, err
+	}
+
+	name := client.Principal
+	if name == "" {
+		name = sig.ClientID
+	}
+	return newCaller(name, nil), nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gay/plugintools/internal/config"
+)
+
+const testHMACSecret = "test-hmac-secret"
+
+// loadHMACConfig 加载只包含一个签名客户端的测试配置
+func loadHMACConfig(t *testing.T) {
+	t.Helper()
+	data := `{
+		"security": {
+			"enable_auth": true,
+			"hmac": {
+				"clients": {
+					"build-service": {"secret": "` + testHMACSecret + `", "principal": "ops-viewer"},
+					"empty-secret": {"secret": ""}
+				},
+				"max_skew": 60
+			}
+		}
+	}`
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signRequest 为请求生成有效的签名
+func signRequest(clientID, method, requestURI, nonce string, signedAt time.Time, body []byte) Signature {
+	ts := strconv.FormatInt(signedAt.Unix(), 10)
+	return Signature{
+		ClientID:  clientID,
+		Timestamp: ts,
+		Nonce:     nonce,
+		Signature: Sign(testHMACSecret, StringToSign(method, requestURI, ts, nonce, body)),
+	}
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	loadHMACConfig(t)
+	body := []byte(`{"operation":"list"}`)
+	const uri = "/api/v1/tools/scheduler"
+
+	tests := []struct {
+		name    string
+		modify  func(sig *Signature, method, uri *string, body *[]byte)
+		skew    time.Duration
+		wantErr string
+	}{
+		{name: "valid"},
+		{name: "valid within skew in the past", skew: -50 * time.Second},
+		{name: "valid within skew in the future", skew: 50 * time.Second},
+		{name: "uppercase signature", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			sig.Signature = strings.ToUpper(sig.Signature)
+		}},
+		{name: "timestamp too old", skew: -2 * time.Minute, wantErr: "outside the allowed clock skew"},
+		{name: "timestamp too far ahead", skew: 2 * time.Minute, wantErr: "outside the allowed clock skew"},
+		{name: "invalid timestamp", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			sig.Timestamp = "yesterday"
+		}, wantErr: "invalid timestamp"},
+		{name: "body tampered", modify: func(_ *Signature, _, _ *string, body *[]byte) {
+			*body = []byte(`{"operation":"delete"}`)
+		}, wantErr: "signature mismatch"},
+		{name: "body appended", modify: func(_ *Signature, _, _ *string, body *[]byte) {
+			*body = append(append([]byte{}, *body...), ' ')
+		}, wantErr: "signature mismatch"},
+		{name: "path tampered", modify: func(_ *Signature, _, uri *string, _ *[]byte) {
+			*uri = "/api/v1/tools/shell-executor"
+		}, wantErr: "signature mismatch"},
+		{name: "query tampered", modify: func(_ *Signature, _, uri *string, _ *[]byte) {
+			*uri += "?force=true"
+		}, wantErr: "signature mismatch"},
+		{name: "method tampered", modify: func(_ *Signature, method, _ *string, _ *[]byte) {
+			*method = "DELETE"
+		}, wantErr: "signature mismatch"},
+		{name: "timestamp changed after signing", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			ts, _ := strconv.ParseInt(sig.Timestamp, 10, 64)
+			sig.Timestamp = strconv.FormatInt(ts+1, 10)
+		}, wantErr: "signature mismatch"},
+		{name: "wrong secret", modify: func(sig *Signature, method, uri *string, body *[]byte) {
+			sig.Signature = Sign("other-secret", StringToSign(*method, *uri, sig.Timestamp, sig.Nonce, *body))
+		}, wantErr: "signature mismatch"},
+		{name: "unknown client", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			sig.ClientID = "intruder"
+		}, wantErr: "unknown client"},
+		{name: "client without secret", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			sig.ClientID = "empty-secret"
+		}, wantErr: "unknown client"},
+		{name: "empty nonce", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			sig.Nonce = ""
+		}, wantErr: "nonce must be"},
+		{name: "oversized nonce", modify: func(sig *Signature, _, _ *string, _ *[]byte) {
+			sig.Nonce = strings.Repeat("n", 129)
+		}, wantErr: "nonce must be"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, requestURI, reqBody := "POST", uri, body
+			sig := signRequest("build-service", method, requestURI, fmt.Sprintf("nonce-%d", i), time.Now().Add(tt.skew), reqBody)
+			if tt.modify != nil {
+				tt.modify(&sig, &method, &requestURI, &reqBody)
+			}
+			caller, err := AuthenticateSignature(sig, method, requestURI, reqBody)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if caller == nil || caller.ID != "ops-viewer" {
+					t.Fatalf("caller = %+v, want ops-viewer", caller)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSignatureRejectsReplay(t *testing.T) {
+	loadHMACConfig(t)
+	body := []byte(`{"operation":"list"}`)
+	sig := signRequest("build-service", "POST", "/api/v1/tools/scheduler", "replayed-nonce", time.Now(), body)
+
+	if _, err := AuthenticateSignature(sig, "POST", "/api/v1/tools/scheduler", body); err != nil {
+		t.Fatalf("first request: unexpected error: %v", err)
+	}
+	if _, err := AuthenticateSignature(sig, "POST", "/api/v1/tools/scheduler", body); err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Fatalf("replayed request: expected nonce error, got %v", err)
+	}
+
+	// 同一nonce重新签名其他请求同样被拒绝
+	other := signRequest("build-service", "GET", "/api/v1/tools", "replayed-nonce", time.Now(), nil)
+	if _, err := AuthenticateSignature(other, "GET", "/api/v1/tools", nil); err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Fatalf("reused nonce: expected nonce error, got %v", err)
+	}
+
+	// 签名无效的请求不消耗nonce
+	bad := signRequest("build-service", "POST", "/api/v1/tools/scheduler", "unused-nonce", time.Now(), body)
+	if _, err := AuthenticateSignature(bad, "POST", "/api/v1/tools/scheduler", []byte("tampered")); err == nil {
+		t.Fatal("tampered request: expected signature error")
+	}
+	if _, err := AuthenticateSignature(bad, "POST", "/api/v1/tools/scheduler", body); err != nil {
+		t.Fatalf("nonce of a rejected request should remain usable: %v", err)
+	}
+}
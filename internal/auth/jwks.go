@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultJWKSCacheTTL 未配置时JWKS的缓存时间
+	defaultJWKSCacheTTL = time.Hour
+	// minJWKSRefreshInterval 两次刷新之间的最小间隔，防止未知kid的令牌或不可用的JWKS使每个请求都重新加载
+	minJWKSRefreshInterval = 30 * time.Second
+	// maxJWKSSize JWKS文档的最大字节数
+	maxJWKSSize = 1 << 20
+)
+
+// jwk JSON Web Key中用到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet 缓存的JWKS，过期或遇到未知kid时从文件或URL重新加载，以支持密钥轮换
+type keySet struct {
+	file   string
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	refreshedAt time.Time
+}
+
+func newKeySet(file, url string, ttl time.Duration) *keySet {
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+	return &keySet{
+		file:   file,
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// key 返回kid对应的公钥，kid为空且只有一个密钥时返回该密钥
+func (ks *keySet) key(kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	// 首次加载或缓存过期时刷新，加载失败后同样限制频率，避免每个请求都等待不可用的JWKS
+	if (ks.keys == nil || time.Since(ks.fetchedAt) > ks.ttl) && time.Since(ks.refreshedAt) >= minJWKSRefreshInterval {
+		ks.refresh()
+	}
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	// 未知kid可能是颁发者轮换了密钥，限制频率地强制刷新一次
+	if time.Since(ks.refreshedAt) >= minJWKSRefreshInterval {
+		ks.refresh()
+		if key, ok := ks.lookup(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no signing key found for kid %q", kid)
+}
+
+// lookup 在缓存中查找公钥
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// refresh 重新加载JWKS，失败时保留之前的密钥
+func (ks *keySet) refresh() {
+	ks.refreshedAt = time.Now()
+	keys, err := ks.load()
+	if err != nil {
+		log.Printf("jwks: failed to load %s: %v", ks.source(), err)
+		return
+	}
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+}
+
+// source 返回JWKS来源，用于日志
+func (ks *keySet) source() string {
+	if ks.file != "" {
+		return ks.file
+	}
+	return ks.url
+}
+
+// load 读取并解析JWKS文档
+func (ks *keySet) load() (map[string]crypto.PublicKey, error) {
+	var data []byte
+	var err error
+	if ks.file != "" {
+		data, err = os.ReadFile(ks.file)
+	} else {
+		data, err = ks.fetch()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// fetch 从URL下载JWKS文档
+func (ks *keySet) fetch() ([]byte, error) {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// parseJWKS 解析JWKS文档中的签名公钥，跳过不支持的密钥
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("jwks: skipping key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey 将JWK转换为公钥，支持RSA、EC（P-256/384/521）和Ed25519
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// decodeBigInt 解码base64url编码的大整数
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
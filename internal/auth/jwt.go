@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// defaultJWTAlgorithms 未配置时允许的签名算法，不包含HS*等对称算法
+var defaultJWTAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+var (
+	keySetsMu sync.Mutex
+	keySets   = make(map[string]*keySet)
+)
+
+// issuerKeySet 返回颁发者的JWKS缓存
+func issuerKeySet(issuer config.JWTIssuer) *keySet {
+	keySetsMu.Lock()
+	defer keySetsMu.Unlock()
+	ks, ok := keySets[issuer.Issuer]
+	if !ok {
+		ks = newKeySet(issuer.JWKSFile, issuer.JWKSURL, time.Duration(issuer.CacheTTL)*time.Second)
+		keySets[issuer.Issuer] = ks
+	}
+	return ks
+}
+
+// findIssuer 根据iss查找受信任的颁发者配置
+func findIssuer(iss string) (config.JWTIssuer, bool) {
+	for _, issuer := range config.Get().Security.JWT.Issuers {
+		if issuer.Issuer == iss {
+			return issuer, true
+		}
+	}
+	return config.JWTIssuer{}, false
+}
+
+// CheckIssuers 校验受信任的颁发者配置：issuer和JWKS必须配置，audience必须配置或显式设置skip_audience
+// 不校验aud时同一颁发者为其他应用签发的令牌也会被接受
+func CheckIssuers(issuers []config.JWTIssuer) error {
+	for i, issuer := range issuers {
+		if issuer.Issuer == "" {
+			return fmt.Errorf("jwt issuer %d: issuer is required", i)
+		}
+		if issuer.JWKSFile == "" && issuer.JWKSURL == "" {
+			return fmt.Errorf("jwt issuer %q: jwks_file or jwks_url is required", issuer.Issuer)
+		}
+		if issuer.Audience == "" && !issuer.SkipAudience {
+			return fmt.Errorf("jwt issuer %q: audience is required (set skip_audience to accept tokens for any audience)", issuer.Issuer)
+		}
+	}
+	return nil
+}
+
+// AuthenticateToken 校验Bearer JWT并返回调用方
+// 令牌必须由配置的颁发者用其JWKS中的密钥签名，且包含有效的exp
+func AuthenticateToken(token string) (*core.Caller, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %v", err)
+	}
+	iss, _ := unverified.Claims.GetIssuer()
+	issuer, ok := findIssuer(iss)
+	if !ok {
+		return nil, fmt.Errorf("untrusted issuer %q", iss)
+	}
+	if issuer.JWKSFile == "" && issuer.JWKSURL == "" {
+		return nil, fmt.Errorf("issuer %q has no JWKS configured", iss)
+	}
+
+	algorithms := issuer.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultJWTAlgorithms
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithIssuer(issuer.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Duration(issuer.Leeway) * time.Second),
+	}
+	if issuer.Audience != "" {
+		options = append(options, jwt.WithAudience(issuer.Audience))
+	} else if !issuer.SkipAudience {
+		return nil, fmt.Errorf("issuer %q has no audience configured", iss)
+	}
+
+	keys := issuerKeySet(issuer)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keys.key(kid)
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return callerFromClaims(issuer, claims)
+}
+
+// callerFromClaims 按颁发者配置将声明映射为调用方和角色
+func callerFromClaims(issuer config.JWTIssuer, claims jwt.MapClaims) (*core.Caller, error) {
+	usernameClaim := issuer.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "sub"
+	}
+	username, _ := claimValue(claims, usernameClaim).(string)
+	if username == "" {
+		return nil, fmt.Errorf("token has no %s claim", usernameClaim)
+	}
+
+	var roles []string
+	if issuer.RolesClaim != "" {
+		for _, name := range claimStrings(claimValue(claims, issuer.RolesClaim)) {
+			if len(issuer.RoleMapping) == 0 {
+				roles = append(roles, name)
+				continue
+			}
+			roles = append(roles, issuer.RoleMapping[name]...)
+		}
+	}
+	return newCaller(issuer.UsernamePrefix+username, roles), nil
+}
+
+// claimValue 获取声明，name中的"."表示访问嵌套对象
+func claimValue(claims jwt.MapClaims, name string) interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+	return value
+}
+
+// claimStrings 将字符串或字符串数组形式的声明转换为切片，字符串按空白切分（兼容scope声明）
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
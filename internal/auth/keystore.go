@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/core"
+)
+
+const (
+	// apiKeyPrefix 密钥存储签发的API密钥前缀，格式为 ptk_<id>_<secret>
+	apiKeyPrefix = "ptk_"
+	// lastUsedGranularity 最近使用时间的更新粒度，避免每次请求都写文件
+	lastUsedGranularity = time.Minute
+)
+
+// APIKey 密钥存储中的一条API密钥记录，只保存加盐哈希
+type APIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Principal   string     `json:"principal,omitempty"` // 密钥所属主体，使用该主体的角色和权限
+	Scopes      []string   `json:"scopes,omitempty"`    // 限制密钥可调用的工具操作，格式同角色授权规则
+	Salt        string     `json:"salt,omitempty"`
+	Hash        string     `json:"hash,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RotatedFrom string     `json:"rotated_from,omitempty"`
+}
+
+// active 检查密钥在指定时间是否可用
+func (k *APIKey) active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// KeyOptions 创建密钥的选项
+type KeyOptions struct {
+	Name      string
+	Principal string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// KeyStore 保存在JSON文件中的API密钥，修改立即写回文件
+type KeyStore struct {
+	path string
+	mu   sync.Mutex
+	keys map[string]*APIKey
+}
+
+// OpenKeyStore 打开密钥存储，文件不存在时创建空存储
+func OpenKeyStore(path string) (*KeyStore, error) {
+	s := &KeyStore{path: path, keys: make(map[string]*APIKey)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %v", err)
+	}
+
+	var doc struct {
+		Keys []*APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid key store %s: %v", path, err)
+	}
+	for _, key := range doc.Keys {
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// save 以原子替换的方式写回文件，调用方需持有锁
+func (s *KeyStore) save() error {
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(map[string]interface{}{"keys": keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".keystore-*")
+	if err != nil {
+		return fmt.Errorf("failed to save key store: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save key store: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save key store: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save key store: %v", err)
+	}
+	return nil
+}
+
+// Create 创建密钥，返回记录和只在此时可见的明文密钥
+func (s *KeyStore) Create(opts KeyOptions) (*APIKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(opts, "")
+}
+
+// create 生成并保存新密钥，调用方需持有锁
+func (s *KeyStore) create(opts KeyOptions, rotatedFrom string) (*APIKey, string, error) {
+	if opts.Name == "" {
+		return nil, "", fmt.Errorf("key name is required")
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expiry must be in the future")
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	salt, err := randomHex(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	key := &APIKey{
+		ID:          id,
+		Name:        opts.Name,
+		Principal:   opts.Principal,
+		Scopes:      opts.Scopes,
+		Salt:        salt,
+		Hash:        hashSecret(salt, secret),
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   opts.ExpiresAt,
+		RotatedFrom: rotatedFrom,
+	}
+	s.keys[id] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, id)
+		return nil, "", err
+	}
+	return key.public(), apiKeyPrefix + id + "_" + secret, nil
+}
+
+// List 列出所有密钥，不包含哈希
+func (s *KeyStore) List() []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key.public())
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// Revoke 吊销密钥
+func (s *KeyStore) Revoke(id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key not found: %s", id)
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := s.save(); err != nil {
+			key.RevokedAt = nil
+			return nil, err
+		}
+	}
+	return key.public(), nil
+}
+
+// Rotate 为密钥签发一个名称、主体和范围相同的新密钥
+// grace大于0时旧密钥在宽限期后过期，否则立即吊销；expiresAt为nil时沿用旧密钥的过期时间
+func (s *KeyStore) Rotate(id string, grace time.Duration, expiresAt *time.Time) (*APIKey, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.keys[id]
+	if !ok {
+		return nil, "", fmt.Errorf("key not found: %s", id)
+	}
+	if !old.active(time.Now()) {
+		return nil, "", fmt.Errorf("key %s is revoked or expired", id)
+	}
+	if expiresAt == nil {
+		expiresAt = old.ExpiresAt
+	}
+
+	oldExpiresAt, oldRevokedAt := old.ExpiresAt, old.RevokedAt
+	now := time.Now().UTC()
+	if grace > 0 {
+		end := now.Add(grace)
+		if old.ExpiresAt == nil || end.Before(*old.ExpiresAt) {
+			old.ExpiresAt = &end
+		}
+	} else {
+		old.RevokedAt = &now
+	}
+
+	key, secret, err := s.create(KeyOptions{
+		Name:      old.Name,
+		Principal: old.Principal,
+		Scopes:    old.Scopes,
+		ExpiresAt: expiresAt,
+	}, old.ID)
+	if err != nil {
+		old.ExpiresAt, old.RevokedAt = oldExpiresAt, oldRevokedAt
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// Verify 校验明文密钥，返回可用的密钥记录
+func (s *KeyStore) Verify(apiKey string) (*APIKey, bool) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(apiKey, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(apiKey, apiKeyPrefix) {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.keys[id]
+	if !exists {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(key.Salt, secret)), []byte(key.Hash)) != 1 {
+		return nil, false
+	}
+	now := time.Now().UTC()
+	if !key.active(now) {
+		return nil, false
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedGranularity {
+		key.LastUsedAt = &now
+		if err := s.save(); err != nil {
+			log.Printf("key store: failed to record last use of %s: %v", id, err)
+		}
+	}
+	return key.public(), true
+}
+
+// public 返回不含盐和哈希的副本
+func (k *APIKey) public() *APIKey {
+	copied := *k
+	copied.Salt = ""
+	copied.Hash = ""
+	return &copied
+}
+
+// caller 返回使用该密钥的调用方
+// 属于主体的密钥使用主体的角色，并受scopes进一步限制；未指定主体时scopes即为授权规则
+func (k *APIKey) caller() *core.Caller {
+	var caller *core.Caller
+	if k.Principal != "" {
+		caller = newCaller(k.Principal, nil)
+	} else {
+		caller = &core.Caller{ID: "key-" + k.ID, Grants: k.Scopes}
+	}
+	caller.Scopes = k.Scopes
+	return caller
+}
+
+// hashSecret 计算加盐的SHA-256哈希，密钥本身是32字节随机数，无需慢哈希
+func hashSecret(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex 生成n字节的随机数并以十六进制返回
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var (
+	keyStoreMu sync.RWMutex
+	keyStore   *KeyStore
+)
+
+// SetKeyStore 设置认证使用的密钥存储
+func SetKeyStore(store *KeyStore) {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+	keyStore = store
+}
+
+// Keys 返回认证使用的密钥存储，未配置时返回nil
+func Keys() *KeyStore {
+	keyStoreMu.RLock()
+	defer keyStoreMu.RUnlock()
+	return keyStore
+}
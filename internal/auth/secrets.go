@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"fmt"
+
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/secrets"
+)
+
+// ResolveSecrets 替换工具参数中的 ${secret:name} 引用，返回新的参数，原参数保持不变以便审计记录引用而不是值
+// 调用方需要 "secret:name" 或 "secret:*" 权限，caller为nil（未启用认证）时总是允许
+func ResolveSecrets(caller *core.Caller, params map[string]interface{}) (map[string]interface{}, error) {
+	return secrets.ResolveParams(params, func(name string) error {
+		if caller != nil && !caller.HasPermission("secret:"+name) && !caller.HasPermission("secret:*") {
+			return fmt.Errorf("secret %s is not permitted", name)
+		}
+		return nil
+	})
+}
@@ -13,22 +13,126 @@ type Config struct {
 		Port         int    `json:"port"`
 		ReadTimeout  int    `json:"read_timeout"`
 		WriteTimeout int    `json:"write_timeout"`
+		TLS          struct {
+			Enabled          bool              `json:"enabled"`
+			CertFile         string            `json:"cert_file"` // 证书文件变更后自动重新加载
+			KeyFile          string            `json:"key_file"`
+			MinVersion       string            `json:"min_version"`       // 1.2 或 1.3，默认1.2
+			ClientCA         string            `json:"client_ca"`         // 校验客户端证书的CA文件
+			ClientAuth       string            `json:"client_auth"`       // none、optional（提供时校验）或 require
+			ClientPrincipals map[string]string `json:"client_principals"` // 客户端证书主题（完整DN或CN）到主体的映射
+		} `json:"tls"`
 	} `json:"server"`
 
 	Security struct {
-		APIKeys    []string `json:"api_keys"`
-		EnableAuth bool     `json:"enable_auth"`
+		APIKeys     []string             `json:"api_keys"`
+		EnableAuth  bool                 `json:"enable_auth"`
+		Permissions map[string][]string  `json:"permissions"` // 未分配主体的API密钥额外拥有的权限，如 "shell:script"
+		Principals  map[string]Principal `json:"principals"`  // 主体名到其API密钥和角色的映射
+		Roles       map[string]Role      `json:"roles"`       // 角色名到授权规则的映射
+		KeyStore    string               `json:"key_store"`   // 保存加盐哈希API密钥的文件，可通过管理接口和keyctl维护
+		JWT         struct {
+			Issuers []JWTIssuer `json:"issuers"` // 接受其签发的Bearer令牌的颁发者
+		} `json:"jwt"`
+		HMAC struct {
+			Clients map[string]HMACClient `json:"clients"`  // 客户端ID到签名密钥的映射
+			MaxSkew int                   `json:"max_skew"` // 请求时间戳与服务器时间允许的偏差（秒），默认300
+		} `json:"hmac"`
 	} `json:"security"`
 
+	Secrets struct {
+		File          string `json:"file"`           // JSON格式的明文密钥文件
+		EncryptedFile string `json:"encrypted_file"` // AES-256-GCM加密的密钥文件，使用secretctl维护
+		KeyFile       string `json:"key_file"`       // 加密文件的主密钥文件，为空时读取 PLUGINTOOLS_SECRETS_KEY 环境变量
+		Env           struct {
+			Enabled bool   `json:"enabled"`
+			Prefix  string `json:"prefix"` // 环境变量名前缀，如 PLUGINTOOLS_SECRET_
+		} `json:"env"`
+	} `json:"secrets"`
+
+	Limits struct {
+		Global    RateLimit            `json:"global"`     // 所有请求共享的限制
+		PerIP     RateLimit            `json:"per_ip"`     // 认证之前按客户端IP的限制，认证失败的请求同样计数
+		PerCaller RateLimit            `json:"per_caller"` // 每个调用方的默认限制
+		Callers   map[string]RateLimit `json:"callers"`    // 按调用方标识覆盖默认限制
+		Tools     map[string]ToolLimit `json:"tools"`      // 按工具ID设置的限制
+	} `json:"limits"`
+
+	Approvals struct {
+		Enabled bool           `json:"enabled"`
+		Timeout int            `json:"timeout"` // 等待审批的秒数，超时后请求失效
+		Rules   []ApprovalRule `json:"rules"`   // 匹配任一规则的调用需要审批
+		Webhook string         `json:"webhook"` // 有新的待审批请求时POST通知的地址
+	} `json:"approvals"`
+
+	Policies struct {
+		Enabled      bool         `json:"enabled"`
+		Timezone     string       `json:"timezone"`      // 计算now变量使用的时区，如 Asia/Shanghai，默认为本地时区
+		LogDecisions bool         `json:"log_decisions"` // 是否记录允许的决定，拒绝的决定总是记录
+		Rules        []PolicyRule `json:"rules"`
+	} `json:"policies"`
+
+	Audit struct {
+		Enabled      bool     `json:"enabled"`
+		File         string   `json:"file"`           // 审计日志文件，JSON Lines格式
+		MaxSize      int64    `json:"max_size"`       // 文件超过该字节数时轮换
+		MaxFiles     int      `json:"max_files"`      // 保留的轮换文件数
+		MaxAge       int      `json:"max_age"`        // 轮换文件保留的天数
+		MaxParamSize int      `json:"max_param_size"` // 参数中字符串值保留的最大长度
+		RedactParams []string `json:"redact_params"`  // 除内置列表外需要隐藏值的参数名
+		Key          string   `json:"key"`            // 条目哈希的HMAC密钥，可使用 ${secret:name} 引用
+		AnchorFile   string   `json:"anchor_file"`    // 记录链末尾的锚点文件，应与审计日志位于不同的存储，不能与 file.* 重名
+	} `json:"audit"`
+
 	Tools struct {
 		FileManager struct {
-			AllowedPaths []string `json:"allowed_paths"`
-			MaxFileSize  int64    `json:"max_file_size"`
+			AllowedPaths      []string `json:"allowed_paths"`
+			MaxFileSize       int64    `json:"max_file_size"`
+			MaxArchiveEntries int      `json:"max_archive_entries"`
+			MaxTreeSize       int64    `json:"max_tree_size"`
+			MaxWatches        int      `json:"max_watches"`
+			MaxUploads        int      `json:"max_uploads"` // 同时进行的上传会话上限
 		} `json:"file_manager"`
 
 		ShellExecutor struct {
-			AllowedCommands []string `json:"allowed_commands"`
-			MaxTimeout      int      `json:"max_timeout"`
+			AllowedCommands []string      `json:"allowed_commands"`
+			MaxTimeout      int           `json:"max_timeout"`
+			KillGracePeriod int           `json:"kill_grace_period"`
+			Sandbox         SandboxConfig `json:"sandbox"`
+			Environment     struct {
+				Inherit   []string `json:"inherit"`   // 从服务器环境继承的变量名
+				Allowlist []string `json:"allowlist"` // 调用方可设置的变量名，支持通配符，为空时不限制
+				Denylist  []string `json:"denylist"`  // 调用方不可设置的变量名，支持通配符
+				Path      string   `json:"path"`      // 命令的PATH
+				Secrets   []string `json:"secrets"`   // 允许注入到环境变量中的密钥名
+			} `json:"environment"`
+			MaxStdinSize     int64                     `json:"max_stdin_size"`
+			ArgumentPolicies map[string]ArgumentPolicy `json:"argument_policies"`
+			Sessions         struct {
+				Enabled     bool `json:"enabled"`
+				MaxSessions int  `json:"max_sessions"` // 同时打开的交互会话上限
+				IdleTimeout int  `json:"idle_timeout"` // 无输入输出多少秒后关闭会话
+			} `json:"sessions"`
+			Output struct {
+				MaxSize  int    `json:"max_size"` // 每个输出流返回的最大字节数
+				Truncate string `json:"truncate"` // 超出时的截断方式：head、tail 或 middle
+			} `json:"output"`
+			Background struct {
+				MaxProcesses int `json:"max_processes"` // 同时保留的后台进程上限，包括保留中的已结束进程
+				BufferSize   int `json:"buffer_size"`   // 每个输出流保留的最大字节数
+				Retention    int `json:"retention"`     // 已结束的进程保留多少秒
+			} `json:"background"`
+			History struct {
+				File       string `json:"file"`        // 持久化的JSON Lines文件，为空时只保存在内存中
+				MaxEntries int    `json:"max_entries"` // 保留的记录条数
+				MaxOutput  int    `json:"max_output"`  // 每条记录保存的stdout/stderr字节数
+			} `json:"history"`
+			Templates map[string]CommandTemplate `json:"templates"` // 命名命令模板
+			Script    struct {
+				Enabled      bool                `json:"enabled"`
+				Interpreters map[string][]string `json:"interpreters"` // 解释器名到命令的映射，如 "python": ["python3", "-I"]
+				MaxSize      int64               `json:"max_size"`     // 脚本的最大字节数
+			} `json:"script"`
 		} `json:"shell_executor"`
 
 		Scheduler struct {
@@ -38,6 +142,120 @@ type Config struct {
 	} `json:"tools"`
 }
 
+// ApprovalRule 需要审批的调用，非空的字段必须全部匹配，tool和operation支持通配符
+type ApprovalRule struct {
+	Tool      string `json:"tool"`
+	Operation string `json:"operation"`
+	Tag       string `json:"tag"` // 工具为操作标注的标签，如 destructive
+}
+
+// PolicyRule 策略规则，tool和operation支持通配符，为空时匹配所有
+// effect为deny时条件成立则拒绝，为require时条件不成立则拒绝
+type PolicyRule struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Tool        string `json:"tool"`
+	Operation   string `json:"operation"`
+	Effect      string `json:"effect"`    // deny 或 require
+	Condition   string `json:"condition"` // 表达式，可使用 principal、tool、operation、params 和 now
+}
+
+// RateLimit 令牌桶限流和每日配额，值为0表示不限制
+type RateLimit struct {
+	Rate       float64 `json:"rate"`        // 每秒补充的请求数
+	Burst      int     `json:"burst"`       // 桶容量，默认为rate向上取整
+	DailyQuota int     `json:"daily_quota"` // 每天（UTC）允许的请求数
+}
+
+// ToolLimit 单个工具的限制，限流和配额按调用方分别计算，并发数为所有调用方合计
+type ToolLimit struct {
+	RateLimit
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+// Principal 调用方主体
+type Principal struct {
+	APIKeys     []string `json:"api_keys"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"` // 额外权限，如 "shell:script"
+}
+
+// Role 角色，Grants中的规则格式为 "tool-id:operation"，支持通配符，以 "!" 开头表示拒绝
+type Role struct {
+	Grants      []string `json:"grants"`
+	Permissions []string `json:"permissions"`
+}
+
+// JWTIssuer 受信任的JWT颁发者（如OIDC身份提供方）
+type JWTIssuer struct {
+	Issuer         string              `json:"issuer"`          // 令牌iss声明必须与之相同
+	Audience       string              `json:"audience"`        // 令牌aud声明必须包含该值，除非设置skip_audience否则必须配置
+	SkipAudience   bool                `json:"skip_audience"`   // 显式关闭aud校验，仅用于不签发aud的颁发者
+	JWKSFile       string              `json:"jwks_file"`       // 本地JWKS文件
+	JWKSURL        string              `json:"jwks_url"`        // JWKS地址，与jwks_file二选一
+	CacheTTL       int                 `json:"cache_ttl"`       // JWKS缓存时间（秒）
+	Algorithms     []string            `json:"algorithms"`      // 允许的签名算法，为空时允许所有非对称算法
+	Leeway         int                 `json:"leeway"`          // 校验exp、nbf时允许的时钟偏差（秒）
+	UsernameClaim  string              `json:"username_claim"`  // 作为调用方标识的声明，默认sub
+	UsernamePrefix string              `json:"username_prefix"` // 调用方标识前缀，用于区分不同颁发者
+	RolesClaim     string              `json:"roles_claim"`     // 包含角色的声明，支持以"."访问嵌套字段，如 realm_access.roles
+	RoleMapping    map[string][]string `json:"role_mapping"`    // 声明中的角色到本地角色的映射，为空时直接使用同名角色
+}
+
+// HMACClient 使用HMAC签名请求的机器客户端
+type HMACClient struct {
+	Secret    string `json:"secret"`    // 签名密钥
+	Principal string `json:"principal"` // 客户端对应的主体，为空时使用客户端ID作为主体名
+}
+
+// ArgumentPolicy 单个命令的参数策略
+type ArgumentPolicy struct {
+	AllowedFlags []string `json:"allowed_flags"` // 允许的选项，为空时不限制
+	ValueFlags   []string `json:"value_flags"`   // 需要携带值的选项，其后的参数视为选项值
+	ArgPatterns  []string `json:"arg_patterns"`  // 非选项参数必须整体匹配其中之一的正则表达式
+	PathArgs     bool     `json:"path_args"`     // 非选项参数视为路径，必须位于file_manager允许的路径内
+	MaxArgs      int      `json:"max_args"`      // 参数个数上限，0表示不限制
+}
+
+// CommandTemplate 管理员定义的命名命令模板，命令中的 {{name}} 由校验后的参数替换
+// 模板命令不受allowed_commands和参数策略限制
+type CommandTemplate struct {
+	Description string          `json:"description"`
+	Command     string          `json:"command"` // 如 "du -sh {{path}}"，按shell引号规则切分后再替换占位符
+	Params      []TemplateParam `json:"params"`
+	WorkingDir  string          `json:"working_dir"`
+	Timeout     int             `json:"timeout"`  // 秒，为0时使用30秒
+	Register    bool            `json:"register"` // 是否同时注册为独立工具，工具ID为模板名
+}
+
+// TemplateParam 模板参数定义
+type TemplateParam struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // string, integer, number, boolean, path
+	Description string      `json:"description"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default"`
+	Pattern     string      `json:"pattern"`    // 字符串值须完整匹配的正则表达式
+	Enum        []string    `json:"enum"`       // 允许的取值
+	Min         *float64    `json:"min"`        // 数值下限
+	Max         *float64    `json:"max"`        // 数值上限
+	AllowDash   bool        `json:"allow_dash"` // 是否允许以"-"开头的值，默认拒绝以免被当作选项
+}
+
+// SandboxConfig Shell命令的资源限制和隔离配置，仅在Linux上生效
+type SandboxConfig struct {
+	Enabled      bool     `json:"enabled"`
+	CPUSeconds   uint64   `json:"cpu_seconds"`   // RLIMIT_CPU
+	MemoryBytes  uint64   `json:"memory_bytes"`  // RLIMIT_AS，启用cgroup时同时写入memory.max
+	OpenFiles    uint64   `json:"open_files"`    // RLIMIT_NOFILE
+	Processes    uint64   `json:"processes"`     // RLIMIT_NPROC，启用cgroup时同时写入pids.max
+	CgroupParent string   `json:"cgroup_parent"` // cgroups v2父目录，为空时不使用cgroup
+	Namespaces   []string `json:"namespaces"`    // mount, pid, network, ipc, uts
+	Seccomp      bool     `json:"seccomp"`       // 启用seccomp系统调用过滤
+	SeccompDeny  []string `json:"seccomp_deny"`  // 禁止的系统调用，为空时使用内置列表
+	RunAsUser    string   `json:"run_as_user"`   // 用户名或 uid[:gid]
+}
+
 var (
 	config *Config
 	once   sync.Once
@@ -0,0 +1,52 @@
+package core
+
+import "context"
+
+// Caller 发起工具调用的身份
+type Caller struct {
+	ID          string   `json:"id"`          // 调用方标识，不包含密钥本身
+	Roles       []string `json:"roles"`       // 调用方拥有的角色
+	Permissions []string `json:"permissions"` // 额外授予的权限，如 "shell:script"
+	Grants      []string `json:"grants"`      // 允许调用的工具操作，如 "scheduler:list"
+	Scopes      []string `json:"scopes"`      // 凭据自身的范围，非空时进一步限制Grants
+}
+
+// HasPermission 检查调用方是否拥有指定权限
+func (c *Caller) HasPermission(permission string) bool {
+	if c == nil {
+		return false
+	}
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type callerKey struct{}
+
+// WithCaller 返回携带调用方信息的context
+func WithCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext 从context中获取调用方，未认证时返回nil
+func CallerFromContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+type paramsKey struct{}
+
+// WithUnresolvedParams 返回携带解析密钥引用之前的调用参数的context，
+// 工具记录参数时使用这些参数，避免保存密钥值
+func WithUnresolvedParams(ctx context.Context, params map[string]interface{}) context.Context {
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+// UnresolvedParamsFromContext 从context中获取解析密钥引用之前的调用参数，未设置时返回nil
+func UnresolvedParamsFromContext(ctx context.Context) map[string]interface{} {
+	params, _ := ctx.Value(paramsKey{}).(map[string]interface{})
+	return params
+}
@@ -1,5 +1,10 @@
 package core
 
+import (
+	"context"
+	"net/http"
+)
+
 // Tool 定义了统一的工具接口
 type Tool interface {
 	// GetInfo 返回工具的基本信息
@@ -10,6 +15,33 @@ type Tool interface {
 	GetParams() []ParamSpec
 }
 
+// RouteProvider 可选接口，工具通过它在 /api/v1/tools/{id}/ 下暴露额外的HTTP端点
+type RouteProvider interface {
+	// Routes 返回子路径到处理函数的映射，如 "watch" 对应 /api/v1/tools/{id}/watch
+	Routes() map[string]http.HandlerFunc
+}
+
+// ContextTool 可选接口，需要调用方信息的工具通过它接收请求的context
+// 服务器对实现了该接口的工具调用ExecuteContext而不是Execute
+type ContextTool interface {
+	ExecuteContext(ctx context.Context, params map[string]interface{}) (interface{}, error)
+}
+
+// OperationTagger 可选接口，工具通过它为操作标注标签，如删除数据的操作标注 "destructive"
+// 同一操作是否覆盖数据可能取决于参数，如复制时的冲突策略
+type OperationTagger interface {
+	OperationTags(operation string, params map[string]interface{}) []string
+}
+
+// ToolLimiter 工具的限流、配额和并发上限，由服务器实现，供不经过HTTP的工具调用（如监听动作）使用
+type ToolLimiter interface {
+	// AcquireTool 占用调用方对工具的限流令牌和并发名额，通过时返回释放并发名额的函数
+	AcquireTool(toolID string, caller *Caller) (func(), error)
+}
+
+// TagDestructive 会删除或覆盖数据、结束进程等不可撤销操作的标签
+const TagDestructive = "destructive"
+
 // ToolInfo 包含工具的基本信息
 type ToolInfo struct {
 	ID          string `json:"id"`          // 工具唯一标识
@@ -0,0 +1,379 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// regexCache 缓存matches使用的正则表达式
+var regexCache sync.Map
+
+// eval 在变量环境中求值表达式
+// 值的类型为 nil、bool、float64、string、[]interface{} 和 map[string]interface{}
+func eval(n node, vars map[string]interface{}) (interface{}, error) {
+	switch n := n.(type) {
+	case literalNode:
+		return n.value, nil
+	case identNode:
+		v, ok := vars[n.name]
+		if !ok {
+			return nil, fmt.Errorf("undefined variable %s", n.name)
+		}
+		return v, nil
+	case listNode:
+		items := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			v, err := eval(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case memberNode:
+		obj, err := eval(n.object, vars)
+		if err != nil {
+			return nil, err
+		}
+		return field(obj, n.name)
+	case indexNode:
+		obj, err := eval(n.object, vars)
+		if err != nil {
+			return nil, err
+		}
+		index, err := eval(n.index, vars)
+		if err != nil {
+			return nil, err
+		}
+		return indexValue(obj, index)
+	case unaryNode:
+		v, err := eval(n.operand, vars)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("operator ! requires a bool, got %s", typeName(v))
+			}
+			return !b, nil
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("operator - requires a number, got %s", typeName(v))
+		}
+		return -f, nil
+	case binaryNode:
+		return evalBinary(n, vars)
+	case callNode:
+		return evalCall(n, vars)
+	case methodNode:
+		return evalMethod(n, vars)
+	}
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+// field 获取map的字段，字段不存在时返回错误
+func field(obj interface{}, name string) (interface{}, error) {
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot access field %s of %s", name, typeName(obj))
+	}
+	v, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", name)
+	}
+	return v, nil
+}
+
+// indexValue 按键访问map或按下标访问列表
+func indexValue(obj, index interface{}) (interface{}, error) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string, got %s", typeName(index))
+		}
+		return field(o, key)
+	case []interface{}:
+		f, ok := index.(float64)
+		if !ok || f != math.Trunc(f) || f < 0 || int(f) >= len(o) {
+			return nil, fmt.Errorf("invalid list index %v", index)
+		}
+		return o[int(f)], nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(obj))
+}
+
+func evalBinary(n binaryNode, vars map[string]interface{}) (interface{}, error) {
+	left, err := eval(n.left, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// && 和 || 短路求值
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s requires bools, got %s", n.op, typeName(left))
+		}
+		if (n.op == "&&" && !l) || (n.op == "||" && l) {
+			return l, nil
+		}
+		right, err := eval(n.right, vars)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator %s requires bools, got %s", n.op, typeName(right))
+		}
+		return r, nil
+	}
+
+	right, err := eval(n.right, vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		switch r := right.(type) {
+		case []interface{}:
+			for _, item := range r {
+				if equal(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			key, ok := left.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key must be a string, got %s", typeName(left))
+			}
+			_, exists := r[key]
+			return exists, nil
+		}
+		return nil, fmt.Errorf("operator in requires a list or map, got %s", typeName(right))
+	case "<", "<=", ">", ">=":
+		cmp, err := compare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+	case "+":
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		}
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s is not defined for %s and %s", n.op, typeName(left), typeName(right))
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.op)
+}
+
+// equal 比较两个值，类型不同时不相等
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// compare 比较两个数字或两个字符串
+func compare(a, b interface{}) (int, error) {
+	switch l := a.(type) {
+	case float64:
+		if r, ok := b.(float64); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if r, ok := b.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", typeName(a), typeName(b))
+}
+
+func evalCall(n callNode, vars map[string]interface{}) (interface{}, error) {
+	// has 检查字段是否存在，参数不求值为错误
+	if n.name == "has" {
+		if len(n.args) != 1 {
+			return nil, fmt.Errorf("has expects 1 argument")
+		}
+		member, ok := n.args[0].(memberNode)
+		if !ok {
+			return nil, fmt.Errorf("has expects a field selection such as params.name")
+		}
+		obj, err := eval(member.object, vars)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		_, exists := m[member.name]
+		return exists, nil
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := eval(arg, vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.name {
+	case "size":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("size expects 1 argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(utf8.RuneCountInString(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size is not defined for %s", typeName(args[0]))
+	case "under":
+		// under 检查清理后的绝对路径是否等于dir或位于dir之下，".." 无法绕过
+		if len(args) != 2 {
+			return nil, fmt.Errorf("under expects 2 arguments")
+		}
+		path, ok1 := args[0].(string)
+		dir, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("under expects strings")
+		}
+		if !filepath.IsAbs(path) {
+			return false, nil
+		}
+		path, dir = filepath.Clean(path), filepath.Clean(dir)
+		return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.name)
+}
+
+func evalMethod(n methodNode, vars map[string]interface{}) (interface{}, error) {
+	obj, err := eval(n.object, vars)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(string)
+	if !ok {
+		return nil, fmt.Errorf("method %s is not defined for %s", n.name, typeName(obj))
+	}
+	if len(n.args) != 1 {
+		return nil, fmt.Errorf("%s expects 1 argument", n.name)
+	}
+	v, err := eval(n.args[0], vars)
+	if err != nil {
+		return nil, err
+	}
+	arg, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a string argument", n.name)
+	}
+
+	switch n.name {
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "matches":
+		re, err := compileRegex(arg)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}
+	return nil, fmt.Errorf("unknown method %s", n.name)
+}
+
+// compileRegex 编译并缓存正则表达式
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// typeName 返回值的类型名，用于错误信息
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
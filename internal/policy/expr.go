@@ -0,0 +1,409 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 表达式语言是CEL的一个子集：
+//
+//	字面量    "str" 'str' 12 1.5 true false null [a, b]
+//	变量      principal tool operation params now
+//	成员访问  params.working_dir params["working-dir"]
+//	运算符    ! - * / % + - == != < <= > >= in && ||
+//	函数      size(x) has(params.x) under(path, dir)
+//	方法      s.startsWith(p) s.endsWith(p) s.contains(p) s.matches(re)
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+// token 词法单元
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex 将表达式切分为词法单元
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					switch src[i+1] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[i+1])
+					}
+					i += 2
+					continue
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ","} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// node 语法树节点
+type node interface{}
+
+type (
+	literalNode struct{ value interface{} }
+	identNode   struct{ name string }
+	listNode    struct{ items []node }
+	memberNode  struct {
+		object node
+		name   string
+	}
+	indexNode struct{ object, index node }
+	callNode  struct {
+		name string
+		args []node
+	}
+	methodNode struct {
+		object node
+		name   string
+		args   []node
+	}
+	unaryNode struct {
+		op      string
+		operand node
+	}
+	binaryNode struct {
+		op          string
+		left, right node
+	}
+)
+
+// parser 递归下降解析器
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse 解析表达式
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept 当前词法单元是指定运算符时消费它
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, found %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{"||", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseRelation()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseRelation()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseRelation() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		op := ""
+		switch {
+		case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+			op = t.text
+		case t.kind == tokIdent && t.text == "in":
+			op = "in"
+		default:
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokOp || (op != "+" && op != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokOp || (op != "*" && op != "/" && op != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op, left, right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{"!", operand}, nil
+	}
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{"-", operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at %d", t.pos)
+			}
+			if p.accept("(") {
+				args, err := p.parseArgs(")")
+				if err != nil {
+					return nil, err
+				}
+				n = methodNode{n, t.text, args}
+			} else {
+				n = memberNode{n, t.text}
+			}
+		case p.accept("["):
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = indexNode{n, index}
+		default:
+			return n, nil
+		}
+	}
+}
+
+// parseArgs 解析以逗号分隔、以end结尾的表达式列表
+func (p *parser) parseArgs(end string) ([]node, error) {
+	var args []node
+	if p.accept(end) {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(end) {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return literalNode{f}, nil
+	case tokString:
+		return literalNode{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		}
+		if p.accept("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			return callNode{t.text, args}, nil
+		}
+		return identNode{t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return listNode{items}, nil
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
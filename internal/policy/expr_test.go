@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		src     string
+		texts   []string
+		kinds   []tokenKind
+		wantErr string
+	}{
+		{
+			src:   `params.path in ["a", 'b']`,
+			texts: []string{"params", ".", "path", "in", "[", "a", ",", "b", "]", ""},
+			kinds: []tokenKind{tokIdent, tokOp, tokIdent, tokIdent, tokOp, tokString, tokOp, tokString, tokOp, tokEOF},
+		},
+		{
+			src:   `now.hour >= 9 && now.hour < 17.5`,
+			texts: []string{"now", ".", "hour", ">=", "9", "&&", "now", ".", "hour", "<", "17.5", ""},
+			kinds: []tokenKind{tokIdent, tokOp, tokIdent, tokOp, tokNumber, tokOp, tokIdent, tokOp, tokIdent, tokOp, tokNumber, tokEOF},
+		},
+		{
+			src:   `"a\"b\n" != !x`,
+			texts: []string{"a\"b\n", "!=", "!", "x", ""},
+			kinds: []tokenKind{tokString, tokOp, tokOp, tokIdent, tokEOF},
+		},
+		{src: `"open`, wantErr: "unterminated string"},
+		{src: `a = b`, wantErr: "unexpected character"},
+		{src: `a & b`, wantErr: "unexpected character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			tokens, err := lex(tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tokens) != len(tt.texts) {
+				t.Fatalf("got %d tokens %v, want %d", len(tokens), tokens, len(tt.texts))
+			}
+			for i, tok := range tokens {
+				if tok.text != tt.texts[i] || tok.kind != tt.kinds[i] {
+					t.Fatalf("token %d = (%d, %q), want (%d, %q)", i, tok.kind, tok.text, tt.kinds[i], tt.texts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{src: `true`},
+		{src: `params.command.startsWith("rm") || "admin" in principal.roles`},
+		{src: `has(params.path) && under(params.path, "/srv")`},
+		{src: `params["working-dir"] == "/tmp" && !(size(params.argv) > 3)`},
+		{src: `-now.hour + 2 * 3 % 4 <= 10`},
+		{src: `[1, 2, 3][0] == 1`},
+		{src: ``, wantErr: "unexpected"},
+		{src: `a &&`, wantErr: "unexpected"},
+		{src: `(a || b`, wantErr: `expected ")"`},
+		{src: `a b`, wantErr: `unexpected "b"`},
+		{src: `size(a,`, wantErr: "unexpected"},
+		{src: `[1, 2`, wantErr: `expected ","`},
+		{src: `params.`, wantErr: "expected field name"},
+		{src: `1.2.3 == 1`, wantErr: "invalid number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := parse(tt.src)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// Input 策略求值的输入
+type Input struct {
+	Caller    *core.Caller
+	ToolID    string
+	Operation string
+	Params    map[string]interface{}
+	Time      time.Time // 为零值时使用当前时间
+}
+
+// RuleResult 单条规则的求值结果
+type RuleResult struct {
+	Policy  string `json:"policy"`
+	Matched bool   `json:"matched"`         // 工具和操作是否匹配规则
+	Value   *bool  `json:"value,omitempty"` // 条件的值
+	Allowed bool   `json:"allowed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Decision 策略决定
+type Decision struct {
+	Allowed bool         `json:"allowed"`
+	Policy  string       `json:"policy,omitempty"` // 拒绝调用的第一条规则
+	Reason  string       `json:"reason,omitempty"`
+	Results []RuleResult `json:"results"`
+}
+
+// rule 编译后的规则
+type rule struct {
+	config.PolicyRule
+	expr node
+}
+
+// Engine 从配置编译的策略集合
+type Engine struct {
+	rules        []rule
+	location     *time.Location
+	logDecisions bool
+}
+
+var (
+	defaultEngine *Engine
+	engineMu      sync.RWMutex
+)
+
+// Compile 编译配置中的策略，任一规则无效时返回错误
+func Compile(cfg *config.Config) (*Engine, error) {
+	e := &Engine{location: time.Local, logDecisions: cfg.Policies.LogDecisions}
+	if cfg.Policies.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Policies.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy timezone: %v", err)
+		}
+		e.location = loc
+	}
+
+	names := make(map[string]bool)
+	for i, r := range cfg.Policies.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("policy %d: name is required", i)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("policy %s: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+		if r.Effect != "deny" && r.Effect != "require" {
+			return nil, fmt.Errorf("policy %s: effect must be deny or require", r.Name)
+		}
+		for _, pattern := range []string{r.Tool, r.Operation} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("policy %s: invalid pattern %q", r.Name, pattern)
+			}
+		}
+		expr, err := parse(r.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %v", r.Name, err)
+		}
+		e.rules = append(e.rules, rule{PolicyRule: r, expr: expr})
+	}
+	return e, nil
+}
+
+// SetDefault 设置工具调用前检查的策略，为nil时不检查
+func SetDefault(e *Engine) {
+	engineMu.Lock()
+	defer engineMu.Unlock()
+	defaultEngine = e
+}
+
+// Default 返回当前的策略
+func Default() *Engine {
+	engineMu.RLock()
+	defer engineMu.RUnlock()
+	return defaultEngine
+}
+
+// Check 使用当前的策略检查工具调用并记录决定，未启用策略时允许
+func Check(input Input) Decision {
+	e := Default()
+	if e == nil {
+		return Decision{Allowed: true, Results: []RuleResult{}}
+	}
+	d := e.Evaluate(input)
+	if !d.Allowed || e.logDecisions {
+		logDecision(input, d)
+	}
+	return d
+}
+
+// Rules 返回策略规则
+func (e *Engine) Rules() []config.PolicyRule {
+	rules := make([]config.PolicyRule, len(e.rules))
+	for i, r := range e.rules {
+		rules[i] = r.PolicyRule
+	}
+	return rules
+}
+
+// Evaluate 按顺序对匹配的规则求值，任一规则拒绝时拒绝
+// 条件求值出错或结果不是bool时视为拒绝
+func (e *Engine) Evaluate(input Input) Decision {
+	vars := e.variables(input)
+	d := Decision{Allowed: true, Results: []RuleResult{}}
+	for _, r := range e.rules {
+		result := RuleResult{Policy: r.Name, Allowed: true}
+		if !matchPattern(r.Tool, input.ToolID) || !matchPattern(r.Operation, input.Operation) {
+			d.Results = append(d.Results, result)
+			continue
+		}
+		result.Matched = true
+
+		v, err := eval(r.expr, vars)
+		b, ok := v.(bool)
+		switch {
+		case err != nil:
+			result.Allowed = false
+			result.Error = err.Error()
+		case !ok:
+			result.Allowed = false
+			result.Error = fmt.Sprintf("condition evaluated to %s, not bool", typeName(v))
+		default:
+			result.Value = &b
+			result.Allowed = (r.Effect == "deny") != b
+		}
+		d.Results = append(d.Results, result)
+
+		if !result.Allowed && d.Allowed {
+			d.Allowed = false
+			d.Policy = r.Name
+			d.Reason = r.Description
+			if result.Error != "" {
+				d.Reason = "policy evaluation failed: " + result.Error
+			} else if d.Reason == "" {
+				d.Reason = fmt.Sprintf("denied by policy %s", r.Name)
+			}
+		}
+	}
+	return d
+}
+
+// variables 构造表达式可使用的变量
+func (e *Engine) variables(input Input) map[string]interface{} {
+	principal := map[string]interface{}{
+		"id":          "",
+		"roles":       []interface{}{},
+		"permissions": []interface{}{},
+	}
+	if input.Caller != nil {
+		principal["id"] = input.Caller.ID
+		principal["roles"] = stringList(input.Caller.Roles)
+		principal["permissions"] = stringList(input.Caller.Permissions)
+	}
+
+	t := input.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	t = t.In(e.location)
+	now := map[string]interface{}{
+		"hour":    float64(t.Hour()),
+		"minute":  float64(t.Minute()),
+		"weekday": float64(t.Weekday()), // 0 为星期日
+		"day":     float64(t.Day()),
+		"month":   float64(t.Month()),
+		"year":    float64(t.Year()),
+		"date":    t.Format("2006-01-02"),
+		"unix":    float64(t.Unix()),
+	}
+
+	return map[string]interface{}{
+		"principal": principal,
+		"tool":      input.ToolID,
+		"operation": input.Operation,
+		"params":    normalize(input.Params),
+		"now":       now,
+	}
+}
+
+// normalize 将参数转换为JSON解码后的类型，使数字统一为float64
+func normalize(params map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	if params == nil {
+		return result
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return result
+	}
+	json.Unmarshal(data, &result)
+	return result
+}
+
+func stringList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
+
+// matchPattern 匹配通配符，空模式匹配所有
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// logDecision 记录策略决定
+func logDecision(input Input, d Decision) {
+	caller := ""
+	if input.Caller != nil {
+		caller = input.Caller.ID
+	}
+	if d.Allowed {
+		log.Printf("policy: allow %s:%s for %q", input.ToolID, input.Operation, caller)
+		return
+	}
+	log.Printf("policy: deny %s:%s for %q by %s: %s", input.ToolID, input.Operation, caller, d.Policy, d.Reason)
+}
@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// compileRule 编译只包含一条规则的策略
+func compileRule(t *testing.T, effect, condition string) *Engine {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Policies.Timezone = "UTC"
+	cfg.Policies.Rules = []config.PolicyRule{{
+		Name:      "test",
+		Tool:      "file-*",
+		Operation: "*",
+		Effect:    effect,
+		Condition: condition,
+	}}
+	e, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEvaluate(t *testing.T) {
+	caller := &core.Caller{ID: "alice", Roles: []string{"ops"}, Permissions: []string{"file-manager:*"}}
+	noon := time.Date(2026, 3, 4, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		effect    string
+		condition string
+		params    map[string]interface{}
+		caller    *core.Caller
+		allowed   bool
+		reason    string
+	}{
+		{name: "under allows path inside dir", effect: "require", condition: `under(params.path, "/srv/data")`,
+			params: map[string]interface{}{"path": "/srv/data/a.txt"}, allowed: true},
+		{name: "under allows dir itself", effect: "require", condition: `under(params.path, "/srv/data/")`,
+			params: map[string]interface{}{"path": "/srv/data"}, allowed: true},
+		{name: "under rejects dot-dot escape", effect: "require", condition: `under(params.path, "/srv/data")`,
+			params: map[string]interface{}{"path": "/srv/data/../../etc/passwd"}},
+		{name: "under rejects sibling prefix", effect: "require", condition: `under(params.path, "/srv/data")`,
+			params: map[string]interface{}{"path": "/srv/database"}},
+		{name: "under rejects relative path", effect: "require", condition: `under(params.path, "/srv/data")`,
+			params: map[string]interface{}{"path": "srv/data/a"}},
+		{name: "has present", effect: "deny", condition: `has(params.recursive) && params.recursive`,
+			params: map[string]interface{}{"recursive": true}},
+		{name: "has absent short circuits", effect: "deny", condition: `has(params.recursive) && params.recursive`,
+			params: map[string]interface{}{}, allowed: true},
+		{name: "has on non-map is false", effect: "deny", condition: `has(params.path.x)`,
+			params: map[string]interface{}{"path": "/a"}, allowed: true},
+		{name: "in list", effect: "require", condition: `"ops" in principal.roles`, caller: caller, allowed: true},
+		{name: "not in list", effect: "require", condition: `"admin" in principal.roles`, caller: caller},
+		{name: "in map keys", effect: "deny", condition: `"force" in params`,
+			params: map[string]interface{}{"force": false}},
+		{name: "in literal list with number", effect: "require", condition: `params.mode in [420, 384]`,
+			params: map[string]interface{}{"mode": 420}, allowed: true},
+		{name: "time of day", effect: "require", condition: `now.hour >= 9 && now.hour < 17 && now.weekday == 3`, allowed: true},
+		{name: "string methods", effect: "deny", condition: `params.path.endsWith(".key") || params.path.matches("^/etc/")`,
+			params: map[string]interface{}{"path": "/etc/hosts"}},
+		{name: "nil caller has empty principal", effect: "require", condition: `principal.id == "" && size(principal.roles) == 0`, allowed: true},
+
+		{name: "missing param fails closed for deny", effect: "deny", condition: `params.path == "/etc"`,
+			params: map[string]interface{}{}, reason: "policy evaluation failed: no such key: path"},
+		{name: "missing param fails closed for require", effect: "require", condition: `params.path != "/etc"`,
+			params: map[string]interface{}{}, reason: "policy evaluation failed"},
+		{name: "non-bool condition fails closed", effect: "deny", condition: `params.path`,
+			params: map[string]interface{}{"path": "/a"}, reason: "not bool"},
+		{name: "type error fails closed", effect: "deny", condition: `params.size > "10"`,
+			params: map[string]interface{}{"size": 5}, reason: "policy evaluation failed"},
+		{name: "in on scalar fails closed", effect: "deny", condition: `"a" in params.path`,
+			params: map[string]interface{}{"path": "abc"}, reason: "operator in requires a list or map"},
+		{name: "under with non-string fails closed", effect: "require", condition: `under(params.path, "/srv")`,
+			params: map[string]interface{}{"path": 1}, reason: "under expects strings"},
+		{name: "unknown function fails closed", effect: "deny", condition: `nope(params)`, reason: "unknown function nope"},
+		{name: "invalid regex fails closed", effect: "deny", condition: `params.path.matches("(")`,
+			params: map[string]interface{}{"path": "/a"}, reason: "policy evaluation failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := compileRule(t, tt.effect, tt.condition)
+			d := e.Evaluate(Input{Caller: tt.caller, ToolID: "file-manager", Operation: "read", Params: tt.params, Time: noon})
+			if d.Allowed != tt.allowed {
+				t.Fatalf("allowed = %v, want %v (reason %q)", d.Allowed, tt.allowed, d.Reason)
+			}
+			if tt.reason != "" && !strings.Contains(d.Reason, tt.reason) {
+				t.Fatalf("reason = %q, want it to contain %q", d.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateSkipsUnmatchedRules(t *testing.T) {
+	e := compileRule(t, "deny", `params.path == "/etc"`)
+	d := e.Evaluate(Input{ToolID: "shell-executor", Operation: "run"})
+	if !d.Allowed || d.Results[0].Matched {
+		t.Fatalf("rule for another tool should not apply: %+v", d)
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    config.PolicyRule
+		wantErr string
+	}{
+		{name: "missing name", rule: config.PolicyRule{Effect: "deny", Condition: "true"}, wantErr: "name is required"},
+		{name: "bad effect", rule: config.PolicyRule{Name: "r", Effect: "allow", Condition: "true"}, wantErr: "effect must be deny or require"},
+		{name: "bad pattern", rule: config.PolicyRule{Name: "r", Tool: "[", Effect: "deny", Condition: "true"}, wantErr: "invalid pattern"},
+		{name: "bad condition", rule: config.PolicyRule{Name: "r", Effect: "deny", Condition: "a &&"}, wantErr: "policy r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Policies.Rules = []config.PolicyRule{tt.rule}
+			_, err := Compile(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
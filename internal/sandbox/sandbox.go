@@ -0,0 +1,39 @@
+// Package sandbox 为外部命令提供资源限制和隔离
+//
+// 限制通过重新执行服务器自身实现：子进程以初始化模式启动，应用rlimit、
+// 挂载、用户切换和seccomp过滤后再exec目标命令，因此 main 函数需要在最开始调用 IsInitProcess。
+package sandbox
+
+import (
+	"os"
+)
+
+const (
+	// initArg 初始化进程的argv[0]
+	initArg = "plugintools-sandbox-init"
+	// specEnv 传递沙箱规格的环境变量，初始化进程在exec目标命令前将其移除
+	specEnv = "PLUGINTOOLS_SANDBOX_SPEC"
+)
+
+// spec 传递给初始化进程的沙箱规格
+type spec struct {
+	Path        string   `json:"path"`
+	Args        []string `json:"args"`
+	CPUSeconds  uint64   `json:"cpu_seconds,omitempty"`
+	MemoryBytes uint64   `json:"memory_bytes,omitempty"`
+	OpenFiles   uint64   `json:"open_files,omitempty"`
+	Processes   uint64   `json:"processes,omitempty"`
+	MountProc   bool     `json:"mount_proc,omitempty"`
+	Seccomp     []string `json:"seccomp,omitempty"`
+	SetUser     bool     `json:"set_user,omitempty"`
+	UID         int      `json:"uid,omitempty"`
+	GID         int      `json:"gid,omitempty"`
+}
+
+// IsInitProcess 判断当前进程是否为沙箱初始化进程
+func IsInitProcess() bool {
+	return len(os.Args) > 0 && os.Args[0] == initArg && os.Getenv(specEnv) != ""
+}
+
+// Cleanup 命令结束后释放沙箱资源
+type Cleanup func()
@@ -0,0 +1,258 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"gay/plugintools/internal/config"
+)
+
+// namespaceFlags 命名空间名称到clone标志的映射
+var namespaceFlags = map[string]uintptr{
+	"mount":   syscall.CLONE_NEWNS,
+	"pid":     syscall.CLONE_NEWPID,
+	"network": syscall.CLONE_NEWNET,
+	"ipc":     syscall.CLONE_NEWIPC,
+	"uts":     syscall.CLONE_NEWUTS,
+}
+
+// Wrap 将命令改写为经由沙箱初始化进程运行
+// 必须在设置好cmd的Env、Dir和SysProcAttr之后、Start之前调用，返回的Cleanup需在命令结束后调用
+func Wrap(cmd *exec.Cmd, cfg config.SandboxConfig) (Cleanup, error) {
+	if !cfg.Enabled {
+		return func() {}, nil
+	}
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	s := spec{
+		Path:        cmd.Path,
+		Args:        cmd.Args,
+		CPUSeconds:  cfg.CPUSeconds,
+		MemoryBytes: cfg.MemoryBytes,
+		OpenFiles:   cfg.OpenFiles,
+		Processes:   cfg.Processes,
+	}
+
+	var cloneflags uintptr
+	for _, name := range cfg.Namespaces {
+		flag, ok := namespaceFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported namespace: %s", name)
+		}
+		cloneflags |= flag
+	}
+	// 新的PID命名空间需要重新挂载/proc，否则ps等命令看到的仍是宿主进程
+	s.MountProc = cloneflags&syscall.CLONE_NEWNS != 0 && cloneflags&syscall.CLONE_NEWPID != 0
+
+	if cfg.Seccomp {
+		s.Seccomp = cfg.SeccompDeny
+		if len(s.Seccomp) == 0 {
+			s.Seccomp = defaultSeccompDeny
+		}
+		if _, err := buildSeccompFilter(s.Seccomp); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.RunAsUser != "" {
+		uid, gid, err := lookupUser(cfg.RunAsUser)
+		if err != nil {
+			return nil, err
+		}
+		s.SetUser, s.UID, s.GID = true, uid, gid
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate sandbox init executable: %v", err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Path = self
+	cmd.Args = []string{initArg}
+	cmd.Env = append(env, specEnv+"="+string(data))
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= cloneflags
+
+	if cfg.CgroupParent == "" {
+		return func() {}, nil
+	}
+	return attachCgroup(cmd, cfg)
+}
+
+// RunAsIDs 返回沙箱中命令运行时的uid和gid，未启用沙箱或未设置run_as_user时ok为false
+func RunAsIDs(cfg config.SandboxConfig) (uid, gid int, ok bool, err error) {
+	if !cfg.Enabled || cfg.RunAsUser == "" {
+		return 0, 0, false, nil
+	}
+	uid, gid, err = lookupUser(cfg.RunAsUser)
+	return uid, gid, err == nil, err
+}
+
+// lookupUser 解析用户名或 uid[:gid]
+func lookupUser(name string) (int, int, error) {
+	uidStr, gidStr, hasGID := strings.Cut(name, ":")
+	if uid, err := strconv.Atoi(uidStr); err == nil {
+		gid := uid
+		if hasGID {
+			if gid, err = strconv.Atoi(gidStr); err != nil {
+				return 0, 0, fmt.Errorf("invalid gid in run_as_user: %s", name)
+			}
+		}
+		return uid, gid, nil
+	}
+
+	u, err := user.Lookup(uidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot resolve run_as_user %s: %v", name, err)
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	return uid, gid, nil
+}
+
+// attachCgroup 为命令创建独立的cgroup v2子组并写入资源限制
+// 父目录需预先启用memory和pids控制器（cgroup.subtree_control）
+func attachCgroup(cmd *exec.Cmd, cfg config.SandboxConfig) (Cleanup, error) {
+	dir := filepath.Join(cfg.CgroupParent, fmt.Sprintf("cmd-%d", time.Now().UnixNano()))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %v", err)
+	}
+
+	limits := map[string]uint64{
+		"memory.max": cfg.MemoryBytes,
+		"pids.max":   cfg.Processes,
+	}
+	for file, value := range limits {
+		if value == 0 {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(strconv.FormatUint(value, 10)), 0644); err != nil {
+			os.Remove(dir)
+			return nil, fmt.Errorf("failed to set %s: %v", file, err)
+		}
+	}
+
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		os.Remove(dir)
+		return nil, fmt.Errorf("failed to open cgroup: %v", err)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+
+	return func() {
+		unix.Close(fd)
+		// 结束cgroup中残留的进程后删除，进程退出是异步的，因此短暂重试
+		os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644)
+		for i := 0; i < 50; i++ {
+			if err := os.Remove(dir); err == nil || os.IsNotExist(err) {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}, nil
+}
+
+// RunInitProcess 沙箱初始化进程入口：应用限制后exec目标命令，不会返回
+func RunInitProcess() {
+	// seccomp过滤器和凭据需要作用在执行exec的线程上
+	runtime.LockOSThread()
+
+	var s spec
+	if err := json.Unmarshal([]byte(os.Getenv(specEnv)), &s); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: invalid spec: %v\n", err)
+		os.Exit(126)
+	}
+	if err := s.apply(); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, specEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	err := syscall.Exec(s.Path, s.Args, env)
+	fmt.Fprintf(os.Stderr, "sandbox: exec %s: %v\n", s.Path, err)
+	os.Exit(127)
+}
+
+// apply 按顺序应用挂载、资源限制、用户切换和seccomp过滤
+func (s *spec) apply() error {
+	if s.MountProc {
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("failed to make mounts private: %v", err)
+		}
+		if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("failed to mount /proc: %v", err)
+		}
+	}
+
+	limits := []struct {
+		resource int
+		value    uint64
+		name     string
+	}{
+		{unix.RLIMIT_CPU, s.CPUSeconds, "cpu"},
+		{unix.RLIMIT_AS, s.MemoryBytes, "memory"},
+		{unix.RLIMIT_NOFILE, s.OpenFiles, "open files"},
+		{unix.RLIMIT_NPROC, s.Processes, "processes"},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := &syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, rlimit); err != nil {
+			return fmt.Errorf("failed to set %s limit: %v", limit.name, err)
+		}
+	}
+
+	if s.SetUser {
+		if err := syscall.Setgroups([]int{s.GID}); err != nil {
+			return fmt.Errorf("failed to set groups: %v", err)
+		}
+		if err := syscall.Setgid(s.GID); err != nil {
+			return fmt.Errorf("failed to set gid: %v", err)
+		}
+		if err := syscall.Setuid(s.UID); err != nil {
+			return fmt.Errorf("failed to set uid: %v", err)
+		}
+	}
+
+	if len(s.Seccomp) > 0 {
+		if err := installSeccomp(s.Seccomp); err != nil {
+			return fmt.Errorf("failed to install seccomp filter: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"gay/plugintools/internal/config"
+)
+
+// Wrap 非Linux平台不支持沙箱，启用时返回错误
+func Wrap(cmd *exec.Cmd, cfg config.SandboxConfig) (Cleanup, error) {
+	if cfg.Enabled {
+		return nil, fmt.Errorf("sandbox is not supported on %s", runtime.GOOS)
+	}
+	return func() {}, nil
+}
+
+// RunAsIDs 非Linux平台不切换用户
+func RunAsIDs(cfg config.SandboxConfig) (uid, gid int, ok bool, err error) {
+	return 0, 0, false, nil
+}
+
+// RunInitProcess 非Linux平台不会以初始化模式启动
+func RunInitProcess() {
+	fmt.Fprintln(os.Stderr, "sandbox: not supported on", runtime.GOOS)
+	os.Exit(126)
+}
@@ -0,0 +1,154 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp相关常量，部分未在x/sys/unix中定义
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetKillProcess  = 0x80000000
+	seccompRetErrno        = 0x00050000
+	seccompRetAllow        = 0x7fff0000
+
+	// seccomp_data中系统调用号和架构字段的偏移
+	seccompDataNr   = 0
+	seccompDataArch = 4
+
+	// x32 ABI的系统调用号带有该标志位
+	x32SyscallBit = 0x40000000
+)
+
+// defaultSeccompDeny 默认禁止的系统调用：内核模块、挂载、命名空间、调试和密钥管理等
+var defaultSeccompDeny = []string{
+	"ptrace", "process_vm_readv", "process_vm_writev",
+	"mount", "umount2", "pivot_root", "chroot",
+	"unshare", "setns",
+	"init_module", "finit_module", "delete_module", "kexec_load",
+	"reboot", "swapon", "swapoff", "acct",
+	"bpf", "perf_event_open", "userfaultfd",
+	"keyctl", "add_key", "request_key",
+	"open_by_handle_at", "settimeofday", "clock_settime",
+}
+
+// syscallNumbers 可在配置中使用的系统调用名称
+var syscallNumbers = map[string]uintptr{
+	"ptrace":            unix.SYS_PTRACE,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"mount":             unix.SYS_MOUNT,
+	"umount2":           unix.SYS_UMOUNT2,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"chroot":            unix.SYS_CHROOT,
+	"unshare":           unix.SYS_UNSHARE,
+	"setns":             unix.SYS_SETNS,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"reboot":            unix.SYS_REBOOT,
+	"swapon":            unix.SYS_SWAPON,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"acct":              unix.SYS_ACCT,
+	"bpf":               unix.SYS_BPF,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"userfaultfd":       unix.SYS_USERFAULTFD,
+	"keyctl":            unix.SYS_KEYCTL,
+	"add_key":           unix.SYS_ADD_KEY,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"open_by_handle_at": unix.SYS_OPEN_BY_HANDLE_AT,
+	"settimeofday":      unix.SYS_SETTIMEOFDAY,
+	"clock_settime":     unix.SYS_CLOCK_SETTIME,
+	"socket":            unix.SYS_SOCKET,
+	"connect":           unix.SYS_CONNECT,
+	"bind":              unix.SYS_BIND,
+	"listen":            unix.SYS_LISTEN,
+	"kill":              unix.SYS_KILL,
+	"setuid":            unix.SYS_SETUID,
+	"setgid":            unix.SYS_SETGID,
+	"clone3":            unix.SYS_CLONE3,
+}
+
+// auditArch 当前架构在seccomp_data中的标识
+func auditArch() (uint32, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, nil
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, nil
+	default:
+		return 0, fmt.Errorf("seccomp is not supported on %s", runtime.GOARCH)
+	}
+}
+
+// bpfStmt 构造BPF语句
+func bpfStmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+// bpfJump 构造BPF跳转
+func bpfJump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// buildSeccompFilter 生成拒绝指定系统调用的BPF程序，被拒绝的调用返回EPERM，其余放行
+func buildSeccompFilter(deny []string) ([]unix.SockFilter, error) {
+	arch, err := auditArch()
+	if err != nil {
+		return nil, err
+	}
+
+	errno := uint32(seccompRetErrno | uint32(unix.EPERM))
+	filter := []unix.SockFilter{
+		// 架构不匹配时直接结束进程，防止通过其他ABI绕过过滤
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataArch),
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		filter = append(filter,
+			bpfJump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1),
+			bpfStmt(unix.BPF_RET|unix.BPF_K, errno),
+		)
+	}
+
+	for _, name := range deny {
+		nr, ok := syscallNumbers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown syscall in seccomp deny list: %s", name)
+		}
+		filter = append(filter,
+			bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			bpfStmt(unix.BPF_RET|unix.BPF_K, errno),
+		)
+	}
+	filter = append(filter, bpfStmt(unix.BPF_RET|unix.BPF_K, seccompRetAllow))
+	return filter, nil
+}
+
+// installSeccomp 设置no_new_privs并为所有线程安装过滤器
+func installSeccomp(deny []string) error {
+	filter, err := buildSeccompFilter(deny)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyEnv 未指定密钥文件时读取主密钥的环境变量
+const KeyEnv = "PLUGINTOOLS_SECRETS_KEY"
+
+// encryptedSecret 加密后的单个密钥
+type encryptedSecret struct {
+	Nonce     string    `json:"nonce"`
+	Data      string    `json:"data"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EncryptedFileStore 以AES-256-GCM加密保存密钥的文件，每个值单独加密并以密钥名作为附加数据，
+// 因此交换两个密钥的密文也无法通过校验
+type EncryptedFileStore struct {
+	path    string
+	aead    cipher.AEAD
+	secrets map[string]encryptedSecret
+	mu      sync.RWMutex
+}
+
+// GenerateKey 生成base64编码的32字节主密钥
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadKey 从文件读取base64编码的主密钥，path为空时读取 PLUGINTOOLS_SECRETS_KEY 环境变量
+func LoadKey(path string) ([]byte, error) {
+	encoded := os.Getenv(KeyEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secrets key: %v", err)
+		}
+		encoded = string(data)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, fmt.Errorf("secrets key is not configured, set key_file or %s", KeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("secrets key must be 32 bytes encoded as base64")
+	}
+	return key, nil
+}
+
+// OpenEncryptedFile 打开加密密钥文件，文件不存在时创建空存储，第一次写入时创建文件
+func OpenEncryptedFile(path string, key []byte) (*EncryptedFileStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &EncryptedFileStore{path: path, aead: aead, secrets: make(map[string]encryptedSecret)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Secrets map[string]encryptedSecret `json:"secrets"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid secrets file %s: %v", path, err)
+	}
+	if file.Secrets != nil {
+		s.secrets = file.Secrets
+	}
+
+	// 打开时解密所有值，主密钥错误或文件被篡改时立即失败，同时登记需要隐藏的值
+	for name := range s.secrets {
+		value, err := s.decrypt(name)
+		if err != nil {
+			return nil, err
+		}
+		Register(value)
+	}
+	return s, nil
+}
+
+// decrypt 解密密钥，调用方需持有锁
+func (s *EncryptedFileStore) decrypt(name string) (string, error) {
+	secret, ok := s.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+	nonce, err1 := base64.StdEncoding.DecodeString(secret.Nonce)
+	data, err2 := base64.StdEncoding.DecodeString(secret.Data)
+	if err1 != nil || err2 != nil || len(nonce) != s.aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupted", name)
+	}
+	plain, err := s.aead.Open(nil, nonce, data, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: wrong key or corrupted file", name)
+	}
+	return string(plain), nil
+}
+
+// Get 实现Store接口
+func (s *EncryptedFileStore) Get(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.decrypt(name)
+}
+
+// List 返回所有密钥名和更新时间，不包含值
+func (s *EncryptedFileStore) List() map[string]time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]time.Time, len(s.secrets))
+	for name, secret := range s.secrets {
+		result[name] = secret.UpdatedAt
+	}
+	return result
+}
+
+// Set 加密保存密钥并写入文件
+func (s *EncryptedFileStore) Set(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := s.aead.Seal(nil, nonce, []byte(value), []byte(name))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[name] = encryptedSecret{
+		Nonce:     base64.StdEncoding.EncodeToString(nonce),
+		Data:      base64.StdEncoding.EncodeToString(data),
+		UpdatedAt: time.Now().UTC(),
+	}
+	Register(value)
+	return s.save()
+}
+
+// Delete 删除密钥并写入文件
+func (s *EncryptedFileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[name]; !ok {
+		return fmt.Errorf("secret not found: %s", name)
+	}
+	delete(s.secrets, name)
+	return s.save()
+}
+
+// save 以临时文件替换的方式写入，文件权限为0600，调用方需持有锁
+func (s *EncryptedFileStore) save() error {
+	data, err := json.MarshalIndent(map[string]interface{}{"version": 1, "secrets": s.secrets}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".secrets-*")
+	if err != nil {
+		return fmt.Errorf("failed to save secrets: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save secrets: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save secrets: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save secrets: %v", err)
+	}
+	return nil
+}
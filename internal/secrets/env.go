@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvStore 从环境变量读取密钥，变量名为前缀加上转为大写、非字母数字字符替换为下划线的密钥名
+// 例如前缀为 PLUGINTOOLS_SECRET_ 时，密钥 smtp.password 读取 PLUGINTOOLS_SECRET_SMTP_PASSWORD
+type EnvStore struct {
+	Prefix string
+}
+
+// NewEnvStore 创建环境变量密钥存储，前缀不能为空，否则引用可以读取任意环境变量
+func NewEnvStore(prefix string) (*EnvStore, error) {
+	if prefix == "" {
+		return nil, fmt.Errorf("secrets.env.prefix is required when environment secrets are enabled")
+	}
+	return &EnvStore{Prefix: prefix}, nil
+}
+
+// Get 实现Store接口，加密文件的主密钥变量不作为密钥提供
+func (s *EnvStore) Get(name string) (string, error) {
+	variable := s.variable(name)
+	if s.Prefix == "" || variable == KeyEnv {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+	value, ok := os.LookupEnv(variable)
+	if !ok {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+	Register(value)
+	return value, nil
+}
+
+// variable 返回密钥对应的环境变量名
+func (s *EnvStore) variable(name string) string {
+	return s.Prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		}
+		return '_'
+	}, name)
+}
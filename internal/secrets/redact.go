@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// redacted 替换密钥值的文本
+	redacted = "[REDACTED]"
+	// minRedactLength 短于该长度的值不做替换，避免误伤普通文本
+	minRedactLength = 4
+)
+
+// redactor 已知的密钥值
+var redactor = struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}{values: make(map[string]bool)}
+
+// Register 记录密钥值，之后经Redact处理的文本中出现的该值都会被替换
+func Register(value string) {
+	if len(value) < minRedactLength {
+		return
+	}
+	redactor.mu.RLock()
+	known := redactor.values[value]
+	redactor.mu.RUnlock()
+	if known {
+		return
+	}
+
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	redactor.values[value] = true
+	// 较长的值优先替换，避免一个密钥是另一个的子串时只替换一部分
+	values := make([]string, 0, len(redactor.values))
+	for v := range redactor.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, redacted)
+	}
+	redactor.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact 将文本中已知的密钥值替换为 [REDACTED]
+func Redact(s string) string {
+	redactor.mu.RLock()
+	replacer := redactor.replacer
+	redactor.mu.RUnlock()
+	if replacer == nil || s == "" {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// RedactParams 返回隐藏了已知密钥值的参数副本，嵌套的对象和数组同样处理
+func RedactParams(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+	return redactValue(params).(map[string]interface{})
+}
+
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return Redact(val)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			result[k] = redactValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			result[i] = redactValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// redactWriter 写入前隐藏密钥值
+type redactWriter struct {
+	w io.Writer
+}
+
+// RedactWriter 返回写入前隐藏密钥值的Writer，用于日志输出
+// log包每条日志只调用一次Write，因此密钥值不会被拆分到两次写入中
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
+
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
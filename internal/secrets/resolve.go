@@ -0,0 +1,149 @@
+package secrets
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// refPattern 密钥引用 ${secret:name}
+var refPattern = regexp.MustCompile(`\$\{secret:([^}]+)\}`)
+
+// HasReference 检查字符串是否包含密钥引用
+func HasReference(s string) bool {
+	return strings.Contains(s, "${secret:") && refPattern.MatchString(s)
+}
+
+// Resolve 将字符串中的 ${secret:name} 替换为默认存储中的密钥值
+// allow不为nil时，每个引用的密钥都需通过allow检查
+func Resolve(s string, allow func(name string) error) (string, error) {
+	if !HasReference(s) {
+		return s, nil
+	}
+	store := Default()
+	if store == nil {
+		return "", fmt.Errorf("no secret store configured")
+	}
+
+	var resolveErr error
+	result := refPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		name := refPattern.FindStringSubmatch(ref)[1]
+		if allow != nil {
+			if err := allow(name); err != nil {
+				resolveErr = err
+				return ref
+			}
+		}
+		value, err := store.Get(name)
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+		Register(value)
+		return value
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return result, nil
+}
+
+// ResolveParams 返回替换了所有字符串值（包括嵌套的map和列表）中密钥引用的参数副本
+func ResolveParams(params map[string]interface{}, allow func(name string) error) (map[string]interface{}, error) {
+	if params == nil {
+		return nil, nil
+	}
+	result := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		resolved, err := resolveParam(v, allow)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", k, err)
+		}
+		result[k] = resolved
+	}
+	return result, nil
+}
+
+func resolveParam(v interface{}, allow func(name string) error) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return Resolve(val, allow)
+	case map[string]interface{}:
+		return ResolveParams(val, allow)
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			resolved, err := resolveParam(item, allow)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// ResolveConfig 替换配置结构中所有字符串字段、列表元素以及map键和值中的密钥引用，v必须是结构体指针
+func ResolveConfig(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ResolveConfig requires a pointer to a struct")
+	}
+	return resolveValue(rv.Elem())
+}
+
+func resolveValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return resolveValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Field(i); field.CanSet() {
+				if err := resolveValue(field); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map中的值不可寻址，复制后修改再写回
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			if err := resolveValue(value); err != nil {
+				return err
+			}
+			newKey := key
+			if key.Kind() == reflect.String && HasReference(key.String()) {
+				resolved, err := Resolve(key.String(), nil)
+				if err != nil {
+					return err
+				}
+				newKey = reflect.ValueOf(resolved).Convert(key.Type())
+				v.SetMapIndex(key, reflect.Value{})
+			}
+			v.SetMapIndex(newKey, value)
+		}
+	case reflect.String:
+		if v.CanSet() && HasReference(v.String()) {
+			resolved, err := Resolve(v.String(), nil)
+			if err != nil {
+				return err
+			}
+			v.SetString(resolved)
+		}
+	}
+	return nil
+}
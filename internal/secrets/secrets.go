@@ -0,0 +1,99 @@
+// Package secrets 为工具和配置提供凭据读取
+//
+// 配置和工具参数中的字符串可以通过 ${secret:name} 引用密钥，读取过的密钥值会被登记，
+// 日志、审计记录和错误信息经Redact处理后不会包含这些值。
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Store 密钥存储接口
+type Store interface {
+	// Get 返回指定名称的密钥值
+	Get(name string) (string, error)
+}
+
+// FileStore 从JSON文件读取密钥，文件内容为 {"name": "value"} 形式
+type FileStore struct {
+	path    string
+	secrets map[string]string
+	mu      sync.RWMutex
+}
+
+// NewFileStore 创建文件密钥存储并加载文件内容
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload 重新加载密钥文件
+func (s *FileStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return fmt.Errorf("invalid secrets file %s: %v", s.path, err)
+	}
+
+	for _, value := range secrets {
+		Register(value)
+	}
+
+	s.mu.Lock()
+	s.secrets = secrets
+	s.mu.Unlock()
+	return nil
+}
+
+// Get 实现Store接口
+func (s *FileStore) Get(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, exists := s.secrets[name]
+	if !exists {
+		return "", fmt.Errorf("secret not found: %s", name)
+	}
+	return value, nil
+}
+
+// Chain 按顺序从多个存储中查找密钥，返回第一个找到的值
+type Chain []Store
+
+// Get 实现Store接口
+func (c Chain) Get(name string) (string, error) {
+	for _, store := range c {
+		if value, err := store.Get(name); err == nil {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("secret not found: %s", name)
+}
+
+var (
+	defaultStore Store
+	defaultMu    sync.RWMutex
+)
+
+// SetDefault 设置解析 ${secret:name} 引用使用的存储
+func SetDefault(store Store) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultStore = store
+}
+
+// Default 返回解析引用使用的存储，未配置时返回nil
+func Default() Store {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultStore
+}
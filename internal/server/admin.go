@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gay/plugintools/internal/auth"
+	"gay/plugintools/internal/core"
+)
+
+// keyAdminPermission 管理API密钥所需的权限
+const keyAdminPermission = "admin:keys"
+
+// keyRequest 创建和轮换密钥的请求体
+type keyRequest struct {
+	Name        string   `json:"name"`
+	Principal   string   `json:"principal"`
+	Scopes      []string `json:"scopes"`
+	ExpiresIn   int      `json:"expires_in"`   // 有效期（秒）
+	ExpiresAt   string   `json:"expires_at"`   // RFC3339格式的过期时间，优先于expires_in
+	GracePeriod int      `json:"grace_period"` // 轮换时旧密钥继续有效的时间（秒）
+}
+
+// expiry 返回请求指定的过期时间，未指定时返回nil
+func (req keyRequest) expiry() (*time.Time, error) {
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_at: %v", err)
+		}
+		t = t.UTC()
+		return &t, nil
+	}
+	if req.ExpiresIn > 0 {
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresIn) * time.Second)
+		return &t, nil
+	}
+	return nil, nil
+}
+
+// hasAdminPermission 检查调用方是否拥有管理权限，未启用认证时调用方为nil，与工具授权一致视为允许
+func hasAdminPermission(caller *core.Caller, permission string) bool {
+	return caller == nil || caller.HasPermission(permission)
+}
+
+// handleAdminKeys handles /api/v1/admin/keys and /api/v1/admin/keys/{id}[/rotate]
+func (s *Server) handleAdminKeys(w http.ResponseWriter, r *http.Request) {
+	caller := core.CallerFromContext(r.Context())
+	if !hasAdminPermission(caller, keyAdminPermission) {
+		http.Error(w, fmt.Sprintf("permission %s is required", keyAdminPermission), http.StatusForbidden)
+		return
+	}
+	actor := r.RemoteAddr
+	if caller != nil {
+		actor = caller.ID
+	}
+	store := auth.Keys()
+	if store == nil {
+		http.Error(w, "Key store is not configured", http.StatusNotFound)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/keys"), "/"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		s.writeJSON(w, store.List())
+	case id == "" && r.Method == http.MethodPost:
+		var req keyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		expiresAt, err := req.expiry()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key, secret, err := store.Create(auth.KeyOptions{
+			Name:      req.Name,
+			Principal: req.Principal,
+			Scopes:    req.Scopes,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("admin: %s created api key %s (%s)", actor, key.ID, key.Name)
+		s.writeJSON(w, map[string]interface{}{"key": key, "api_key": secret})
+	case id != "" && action == "" && r.Method == http.MethodDelete:
+		key, err := store.Revoke(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("admin: %s revoked api key %s (%s)", actor, key.ID, key.Name)
+		s.writeJSON(w, key)
+	case id != "" && action == "rotate" && r.Method == http.MethodPost:
+		var req keyRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		expiresAt, err := req.expiry()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key, secret, err := store.Rotate(id, time.Duration(req.GracePeriod)*time.Second, expiresAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("admin: %s rotated api key %s to %s (%s)", actor, id, key.ID, key.Name)
+		s.writeJSON(w, map[string]interface{}{"key": key, "api_key": secret})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/audit"
+	"gay/plugintools/internal/auth"
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+	"gay/plugintools/internal/secrets"
+)
+
+const (
+	// approvePermission 审批其他调用方请求所需的权限
+	approvePermission = "approvals:approve"
+	// defaultApprovalTimeout 未配置时等待审批的时间
+	defaultApprovalTimeout = time.Hour
+	// approvalRetention 已完成的审批请求保留的时间
+	approvalRetention = 24 * time.Hour
+)
+
+// approval 一个等待或已完成审批的工具调用
+type approval struct {
+	ID        string                 `json:"id"`
+	ToolID    string                 `json:"tool_id"`
+	Operation string                 `json:"operation"`
+	Params    map[string]interface{} `json:"params"` // 隐藏敏感参数后的参数，审批人看到只隐藏密钥值的完整参数
+	Requester string                 `json:"requester"`
+	Status    string                 `json:"status"` // pending, approved, rejected, expired
+	CreatedAt time.Time              `json:"created_at"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	DecidedBy string                 `json:"decided_by,omitempty"`
+	DecidedAt *time.Time             `json:"decided_at,omitempty"`
+	Comment   string                 `json:"comment,omitempty"`
+	Result    interface{}            `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+
+	caller *core.Caller
+	params map[string]interface{}
+}
+
+// approvalStore 内存中的审批请求，服务器重启后丢失
+type approvalStore struct {
+	mu        sync.Mutex
+	approvals map[string]*approval
+}
+
+func newApprovalStore() *approvalStore {
+	return &approvalStore{approvals: make(map[string]*approval)}
+}
+
+// add 保存新的审批请求
+func (st *approvalStore) add(a *approval) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire(time.Now())
+	st.approvals[a.ID] = a
+}
+
+// expire 将超时的请求标记为expired，并删除超过保留时间的已完成请求，调用方需持有锁
+func (st *approvalStore) expire(now time.Time) {
+	for id, a := range st.approvals {
+		if a.Status == "pending" && now.After(a.ExpiresAt) {
+			a.Status = "expired"
+		}
+		if a.Status != "pending" && now.Sub(a.ExpiresAt) > approvalRetention {
+			delete(st.approvals, id)
+		}
+	}
+}
+
+// snapshot 返回请求的副本，用于在锁外编码
+func (a *approval) snapshot() *approval {
+	copied := *a
+	return &copied
+}
+
+// forApprover 返回带有完整参数的副本，参数中只隐藏密钥值，供审批人判断调用内容
+func (a *approval) forApprover() *approval {
+	copied := a.snapshot()
+	copied.Params = secrets.RedactParams(a.params)
+	return copied
+}
+
+// get 获取请求的副本
+func (st *approvalStore) get(id string) (*approval, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire(time.Now())
+	a, ok := st.approvals[id]
+	if !ok {
+		return nil, fmt.Errorf("approval not found: %s", id)
+	}
+	return a.snapshot(), nil
+}
+
+// list 列出请求，最新的在前；requester非空时只列出该调用方的请求
+func (st *approvalStore) list(status, requester string) []*approval {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expire(time.Now())
+
+	result := []*approval{}
+	for _, a := range st.approvals {
+		if (status == "" || a.Status == status) && (requester == "" || a.Requester == requester) {
+			result = append(result, a.snapshot())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// decide 将待审批的请求标记为approved或rejected，返回决定前的请求
+// 同一请求只能被决定一次，审批人不能审批自己的请求
+func (st *approvalStore) decide(id, status, approver, comment string) (*approval, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	st.expire(now)
+
+	a, ok := st.approvals[id]
+	if !ok {
+		return nil, fmt.Errorf("approval not found: %s", id)
+	}
+	if a.Status != "pending" {
+		return nil, fmt.Errorf("approval %s is already %s", id, a.Status)
+	}
+	if a.Requester != "" && a.Requester == approver {
+		return nil, fmt.Errorf("callers cannot approve their own requests")
+	}
+	a.Status = status
+	a.DecidedBy = approver
+	a.DecidedAt = &now
+	a.Comment = comment
+	return a, nil
+}
+
+// finish 记录审批通过后执行的结果
+func (st *approvalStore) finish(a *approval, result interface{}, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	a.Result = result
+	if err != nil {
+		a.Error = secrets.Redact(err.Error())
+	}
+}
+
+// requestApproval 将调用保存为待审批请求并通知审批人，返回202和请求信息
+func (s *Server) requestApproval(w http.ResponseWriter, r *http.Request, tool core.Tool, operation string, params map[string]interface{}) *approval {
+	timeout := time.Duration(config.Get().Approvals.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	now := time.Now()
+	a := &approval{
+		ID:        fmt.Sprintf("apr_%d", now.UnixNano()),
+		ToolID:    tool.GetInfo().ID,
+		Operation: operation,
+		Params:    audit.Sanitize(params),
+		Status:    "pending",
+		CreatedAt: now,
+		ExpiresAt: now.Add(timeout),
+		caller:    core.CallerFromContext(r.Context()),
+		params:    params,
+	}
+	if a.caller != nil {
+		a.Requester = a.caller.ID
+	}
+	s.approvals.add(a)
+
+	log.Printf("approval %s: %s requested %s:%s, waiting for approval until %s", a.ID, a.Requester, a.ToolID, a.Operation, a.ExpiresAt.Format(time.RFC3339))
+	go notifyApproval(a.forApprover())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(a.snapshot())
+	return a
+}
+
+// notifyApproval 向配置的webhook发送待审批通知
+func notifyApproval(a *approval) {
+	webhook := config.Get().Approvals.Webhook
+	if webhook == "" {
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{"event": "approval.pending", "approval": a})
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("approval %s: failed to notify %s: %v", a.ID, webhook, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("approval %s: notification returned %s", a.ID, resp.Status)
+	}
+}
+
+// handleApprovals handles /api/v1/approvals, /api/v1/approvals/{id} and /api/v1/approvals/{id}/{approve|reject}
+// 审批人可以查看所有请求，其他调用方只能查看自己的请求；未启用认证时调用方视为审批人
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	caller := core.CallerFromContext(r.Context())
+	approver := hasAdminPermission(caller, approvePermission)
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/approvals"), "/"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		requester := ""
+		if !approver {
+			requester = caller.ID
+		}
+		approvals := s.approvals.list(r.URL.Query().Get("status"), requester)
+		if approver {
+			for i, a := range approvals {
+				approvals[i] = a.forApprover()
+			}
+		}
+		s.writeJSON(w, approvals)
+	case id != "" && action == "" && r.Method == http.MethodGet:
+		a, err := s.approvals.get(id)
+		if err != nil || (!approver && a.Requester != caller.ID) {
+			http.Error(w, fmt.Sprintf("approval not found: %s", id), http.StatusNotFound)
+			return
+		}
+		if approver {
+			a = a.forApprover()
+		}
+		s.writeJSON(w, a)
+	case id != "" && (action == "approve" || action == "reject") && r.Method == http.MethodPost:
+		if !approver {
+			http.Error(w, fmt.Sprintf("permission %s is required", approvePermission), http.StatusForbidden)
+			return
+		}
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		decidedBy := ""
+		if caller != nil {
+			decidedBy = caller.ID
+		}
+		s.decideApproval(w, id, action, decidedBy, req.Comment)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// decideApproval 记录审批决定，通过时以请求者的身份执行工具调用
+func (s *Server) decideApproval(w http.ResponseWriter, id, action, approver, comment string) {
+	status := "approved"
+	if action == "reject" {
+		status = "rejected"
+	}
+	a, err := s.approvals.decide(id, status, approver, comment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("approval %s: %s by %s", a.ID, status, approver)
+
+	entry := audit.Entry{
+		Caller:     a.Requester,
+		ToolID:     a.ToolID,
+		Operation:  a.Operation,
+		Params:     a.params,
+		ApprovalID: a.ID,
+	}
+	if status == "rejected" {
+		entry.ErrorCode = http.StatusForbidden
+		entry.Error = fmt.Sprintf("rejected by %s", approver)
+		s.writeAudit(entry)
+		s.writeJSON(w, a.forApprover())
+		return
+	}
+
+	start := time.Now()
+	result, err := s.executeApproved(a)
+	s.approvals.finish(a, result, err)
+
+	entry.ApprovedBy = approver
+	entry.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		entry.ErrorCode = http.StatusInternalServerError
+		entry.Error = err.Error()
+	} else {
+		entry.Success = true
+		entry.Result = audit.Summarize(result)
+	}
+	s.writeAudit(entry)
+	s.writeJSON(w, a.forApprover())
+}
+
+// executeApproved 以请求者的身份执行已审批的调用，执行前重新检查授权、策略和限流
+func (s *Server) executeApproved(a *approval) (interface{}, error) {
+	tool, err := s.registry.Get(a.ToolID)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.Authorize(a.caller, a.ToolID, a.Operation) {
+		return nil, fmt.Errorf("operation %s is no longer permitted for %s", a.Operation, a.Requester)
+	}
+	// 策略可能依赖时间，审批通过时按执行时刻重新检查
+	if decision := policy.Check(policy.Input{Caller: a.caller, ToolID: a.ToolID, Operation: a.Operation, Params: a.params}); !decision.Allowed {
+		return nil, fmt.Errorf("denied by policy %s: %s", decision.Policy, decision.Reason)
+	}
+	// 审批通过的调用与直接调用一样计入请求者对工具的限流、配额和并发上限
+	release, err := s.AcquireTool(a.ToolID, a.caller)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	params, err := auth.ResolveSecrets(a.caller, a.params)
+	if err != nil {
+		return nil, err
+	}
+	if ct, ok := tool.(core.ContextTool); ok {
+		ctx := core.WithUnresolvedParams(core.WithCaller(context.Background(), a.caller), a.params)
+		return ct.ExecuteContext(ctx, params)
+	}
+	return tool.Execute(params)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gay/plugintools/internal/audit"
+	"gay/plugintools/internal/core"
+)
+
+// auditPermission 查询审计日志所需的权限
+const auditPermission = "admin:audit"
+
+// SetAuditLog 设置记录工具调用的审计日志
+func (s *Server) SetAuditLog(auditLog *audit.Log) {
+	s.audit = auditLog
+}
+
+// recordAudit 记录一次工具调用，未配置审计日志时不记录
+func (s *Server) recordAudit(r *http.Request, toolID, operation string, params map[string]interface{}, status int, errMsg string, result interface{}, start time.Time) {
+	if s.audit == nil {
+		return
+	}
+	entry := audit.Entry{
+		RemoteAddr: r.RemoteAddr,
+		ToolID:     toolID,
+		Operation:  operation,
+		Params:     params,
+		Success:    status < http.StatusBadRequest,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if caller := core.CallerFromContext(r.Context()); caller != nil {
+		entry.Caller = caller.ID
+	}
+	if entry.Success {
+		entry.Result = audit.Summarize(result)
+	} else {
+		entry.ErrorCode = status
+		entry.Error = errMsg
+		if entry.Error == "" {
+			entry.Error = http.StatusText(status)
+		}
+	}
+	s.writeAudit(entry)
+}
+
+// writeAudit 写入一条审计记录，未配置审计日志时不记录
+func (s *Server) writeAudit(entry audit.Entry) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Record(entry); err != nil {
+		log.Printf("audit: failed to record %s call: %v", entry.ToolID, err)
+	}
+}
+
+// handleAudit handles GET /api/v1/audit and GET /api/v1/audit/verify
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if !hasAdminPermission(core.CallerFromContext(r.Context()), auditPermission) {
+		http.Error(w, "permission "+auditPermission+" is required", http.StatusForbidden)
+		return
+	}
+	if s.audit == nil {
+		http.Error(w, "Audit log is not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == "/api/v1/audit/verify" {
+		result, err := s.audit.Verify()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writeJSON(w, result)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Caller:    query.Get("caller"),
+		ToolID:    query.Get("tool_id"),
+		Operation: query.Get("operation"),
+		Failed:    query.Get("failed") == "true",
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid "+name+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, entries)
+}
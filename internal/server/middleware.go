@@ -1,11 +1,19 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"gay/plugintools/internal/auth"
 	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
 )
 
 // Logger 日志中间件
@@ -29,6 +37,40 @@ func Logger(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// maxSignedBodySize 签名请求的请求体需要完整读入内存计算哈希，超过该大小时拒绝
+const maxSignedBodySize = 32 << 20
+
+// Signature HMAC请求签名认证中间件，需在Auth之前执行
+// 携带 X-Signature 的请求在此校验并设置调用方，其他请求交给Auth处理
+func Signature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.Get().Security.EnableAuth || r.Header.Get("X-Signature") == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+		if err != nil {
+			http.Error(w, "Request body is too large to sign", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		caller, err := auth.AuthenticateSignature(auth.Signature{
+			ClientID:  r.Header.Get("X-Client-Id"),
+			Timestamp: r.Header.Get("X-Timestamp"),
+			Nonce:     r.Header.Get("X-Nonce"),
+			Signature: r.Header.Get("X-Signature"),
+		}, r.Method, r.URL.RequestURI(), body)
+		if err != nil {
+			log.Printf("auth: rejected signed request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, fmt.Sprintf("Invalid request signature: %v", err), http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(core.WithCaller(r.Context(), caller)))
+	}
+}
+
 // Auth 认证中间件
 func Auth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -38,28 +80,48 @@ func Auth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// 已通过签名认证
+		if core.CallerFromContext(r.Context()) != nil {
+			next(w, r)
+			return
+		}
+
+		// 优先使用Bearer令牌
+		if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+			caller, err := auth.AuthenticateToken(strings.TrimSpace(token))
+			if err != nil {
+				log.Printf("auth: rejected bearer token from %s: %v", r.RemoteAddr, err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+			next(w, r.WithContext(core.WithCaller(r.Context(), caller)))
+			return
+		}
+
 		// 从请求头获取API密钥
 		apiKey := r.Header.Get("X-API-Key")
+		if apiKey == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			// 没有其他凭据时使用已校验的客户端证书
+			if caller, ok := auth.AuthenticateCertificate(r.TLS.VerifiedChains[0][0]); ok {
+				next(w, r.WithContext(core.WithCaller(r.Context(), caller)))
+				return
+			}
+		}
 		if apiKey == "" {
 			http.Error(w, "API key is required", http.StatusUnauthorized)
 			return
 		}
 
-		// 验证API密钥
-		valid := false
-		for _, key := range cfg.Security.APIKeys {
-			if apiKey == key {
-				valid = true
-				break
-			}
-		}
-
-		if !valid {
+		// 验证API密钥并解析调用方
+		caller, ok := auth.Authenticate(apiKey)
+		if !ok {
 			http.Error(w, "Invalid API key", http.StatusUnauthorized)
 			return
 		}
 
-		next(w, r)
+		// 将调用方信息放入请求context，供授权检查、工具权限检查和审计使用
+		next(w, r.WithContext(core.WithCaller(r.Context(), caller)))
 	}
 }
 
@@ -74,6 +136,28 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.ResponseWriter.WriteHeader(status)
 }
 
+// Flush 支持流式响应（如SSE）
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持连接升级（如WebSocket）
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	rw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap 供 http.ResponseController 访问底层ResponseWriter
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Chain 链接多个中间件
 func Chain(handler http.HandlerFunc, middlewares ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
 	for _, m := range middlewares {
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+)
+
+// policyPermission 查看策略和试运行求值所需的权限
+const policyPermission = "admin:policies"
+
+// evaluateRequest 试运行求值的请求体
+type evaluateRequest struct {
+	Principal *core.Caller           `json:"principal"` // 为空时使用当前调用方
+	Tool      string                 `json:"tool"`
+	Operation string                 `json:"operation"`
+	Params    map[string]interface{} `json:"params"`
+	Time      string                 `json:"time"` // RFC3339格式，为空时使用当前时间
+}
+
+// handlePolicies handles GET /api/v1/policies and POST /api/v1/policies/evaluate
+func (s *Server) handlePolicies(w http.ResponseWriter, r *http.Request) {
+	caller := core.CallerFromContext(r.Context())
+	if !hasAdminPermission(caller, policyPermission) {
+		http.Error(w, fmt.Sprintf("permission %s is required", policyPermission), http.StatusForbidden)
+		return
+	}
+	engine := policy.Default()
+
+	switch {
+	case r.URL.Path == "/api/v1/policies" && r.Method == http.MethodGet:
+		rules := []config.PolicyRule{}
+		if engine != nil {
+			rules = engine.Rules()
+		}
+		s.writeJSON(w, map[string]interface{}{"enabled": engine != nil, "rules": rules})
+	case r.URL.Path == "/api/v1/policies/evaluate" && r.Method == http.MethodPost:
+		if engine == nil {
+			http.Error(w, "Policies are not enabled", http.StatusNotFound)
+			return
+		}
+		var req evaluateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Tool == "" {
+			http.Error(w, "tool is required", http.StatusBadRequest)
+			return
+		}
+		input := policy.Input{Caller: caller, ToolID: req.Tool, Operation: req.Operation, Params: req.Params}
+		if req.Principal != nil {
+			input.Caller = req.Principal
+		}
+		if req.Time != "" {
+			t, err := time.Parse(time.RFC3339, req.Time)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid time: %v", err), http.StatusBadRequest)
+				return
+			}
+			input.Time = t
+		}
+		// 试运行只求值，不记录决定
+		s.writeJSON(w, engine.Evaluate(input))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// limiterPruneInterval 清理空闲令牌桶和过期配额计数的间隔
+const limiterPruneInterval = time.Minute
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// quotaCounter 当天已使用的请求数
+type quotaCounter struct {
+	day  string
+	used int
+}
+
+// limitCheck 一次请求需要通过的一项限制
+type limitCheck struct {
+	key   string
+	limit config.RateLimit
+}
+
+// limitResult 限制检查结果，用于设置响应头
+type limitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+	reason     string
+}
+
+// limiter 内存中的限流、配额和并发计数，服务器重启后重置
+type limiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	quotas   map[string]*quotaCounter
+	running  map[string]int
+	prunedAt time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		buckets: make(map[string]*tokenBucket),
+		quotas:  make(map[string]*quotaCounter),
+		running: make(map[string]int),
+	}
+}
+
+// burst 返回令牌桶容量
+func burst(limit config.RateLimit) float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return math.Max(1, math.Ceil(limit.Rate))
+}
+
+// allow 检查所有限制，全部通过时才扣减，避免一项被拒绝时其他限制被白白消耗
+// 通过时返回剩余量最少的一项限制的状态
+func (l *limiter) allow(checks []limitCheck) limitResult {
+	now := time.Now()
+	day := now.UTC().Format("2006-01-02")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	best := limitResult{allowed: true, remaining: -1}
+	for _, c := range checks {
+		if c.limit.Rate > 0 {
+			b := l.bucket(c.key, c.limit, now)
+			capacity := burst(c.limit)
+			if b.tokens < 1 {
+				wait := time.Duration((1 - b.tokens) / c.limit.Rate * float64(time.Second))
+				return limitResult{limit: int(capacity), retryAfter: wait, reset: wait, reason: "rate limit exceeded"}
+			}
+			remaining := int(b.tokens) - 1
+			if best.remaining < 0 || remaining < best.remaining {
+				reset := time.Duration((capacity - b.tokens + 1) / c.limit.Rate * float64(time.Second))
+				best = limitResult{allowed: true, limit: int(capacity), remaining: remaining, reset: reset}
+			}
+		}
+		if c.limit.DailyQuota > 0 {
+			q := l.quota(c.key, day)
+			untilTomorrow := time.Until(now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour))
+			if q.used >= c.limit.DailyQuota {
+				return limitResult{limit: c.limit.DailyQuota, retryAfter: untilTomorrow, reset: untilTomorrow, reason: "daily quota exceeded"}
+			}
+			remaining := c.limit.DailyQuota - q.used - 1
+			if best.remaining < 0 || remaining < best.remaining {
+				best = limitResult{allowed: true, limit: c.limit.DailyQuota, remaining: remaining, reset: untilTomorrow}
+			}
+		}
+	}
+
+	for _, c := range checks {
+		if c.limit.Rate > 0 {
+			l.buckets[c.key].tokens--
+		}
+		if c.limit.DailyQuota > 0 {
+			l.quotas[c.key].used++
+		}
+	}
+	return best
+}
+
+// bucket 获取并补充令牌桶，调用方需持有锁
+func (l *limiter) bucket(key string, limit config.RateLimit, now time.Time) *tokenBucket {
+	capacity := burst(limit)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	return b
+}
+
+// quota 获取当天的配额计数，调用方需持有锁
+func (l *limiter) quota(key, day string) *quotaCounter {
+	q, ok := l.quotas[key]
+	if !ok || q.day != day {
+		q = &quotaCounter{day: day}
+		l.quotas[key] = q
+	}
+	return q
+}
+
+// prune 定期删除一段时间未使用的令牌桶和前一天的配额计数，调用方需持有锁
+func (l *limiter) prune(now time.Time) {
+	if now.Sub(l.prunedAt) < limiterPruneInterval {
+		return
+	}
+	l.prunedAt = now
+	day := now.UTC().Format("2006-01-02")
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+	for key, q := range l.quotas {
+		if q.day != day {
+			delete(l.quotas, key)
+		}
+	}
+}
+
+// acquire 占用一个并发名额，已满时返回false
+func (l *limiter) acquire(key string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[key] >= max {
+		return false
+	}
+	l.running[key]++
+	return true
+}
+
+// release 释放并发名额
+func (l *limiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[key]--
+	if l.running[key] <= 0 {
+		delete(l.running, key)
+	}
+}
+
+// callerKey 返回限流使用的调用方标识，未启用认证时使用客户端IP
+func callerKey(r *http.Request) string {
+	if caller := core.CallerFromContext(r.Context()); caller != nil {
+		return caller.ID
+	}
+	return clientIP(r)
+}
+
+// clientIP 返回请求的客户端IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeLimitHeaders 写入 X-RateLimit-* 响应头，被拒绝时同时写入 Retry-After
+func writeLimitHeaders(w http.ResponseWriter, result limitResult) {
+	if result.remaining < 0 && result.allowed {
+		return
+	}
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(result.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(max(result.remaining, 0)))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+	if !result.allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(result.retryAfter.Seconds())))))
+	}
+}
+
+// ClientLimit 全局和按客户端IP的限流与配额中间件，需在Auth和Signature之前执行，
+// 使认证失败的请求同样被计数，防止无限制地尝试凭据
+func (s *Server) ClientLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().Limits
+		result := s.limiter.allow([]limitCheck{
+			{key: "global", limit: cfg.Global},
+			{key: "ip:" + clientIP(r), limit: cfg.PerIP},
+		})
+		writeLimitHeaders(w, result)
+		if !result.allowed {
+			http.Error(w, result.reason, http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RateLimit 按调用方的限流与配额中间件，需在Auth之后执行
+func (s *Server) RateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().Limits
+		caller := callerKey(r)
+		callerLimit, ok := cfg.Callers[caller]
+		if !ok {
+			callerLimit = cfg.PerCaller
+		}
+
+		result := s.limiter.allow([]limitCheck{
+			{key: "caller:" + caller, limit: callerLimit},
+		})
+		writeLimitHeaders(w, result)
+		if !result.allowed {
+			http.Error(w, result.reason, http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// acquireTool 检查key对工具的限流、配额和工具的并发上限，通过时返回释放并发名额的函数
+func (s *Server) acquireTool(toolID, key string) (func(), limitResult) {
+	limit, ok := config.Get().Limits.Tools[toolID]
+	if !ok {
+		return func() {}, limitResult{allowed: true, remaining: -1}
+	}
+
+	// 先占用并发名额，避免并发已满时消耗限流令牌和配额
+	release := func() {}
+	if limit.MaxConcurrent > 0 {
+		key := "running:" + toolID
+		if !s.limiter.acquire(key, limit.MaxConcurrent) {
+			return nil, limitResult{retryAfter: time.Second, reason: "too many concurrent executions"}
+		}
+		release = func() { s.limiter.release(key) }
+	}
+
+	result := s.limiter.allow([]limitCheck{
+		{key: "tool:" + toolID + ":" + key, limit: limit.RateLimit},
+	})
+	if !result.allowed {
+		release()
+		return nil, result
+	}
+	return release, result
+}
+
+// limitTool 检查调用方对工具的限流、配额和工具的并发上限，通过时返回释放并发名额的函数
+func (s *Server) limitTool(w http.ResponseWriter, r *http.Request, toolID string) (func(), bool) {
+	release, result := s.acquireTool(toolID, callerKey(r))
+	if result.limit > 0 {
+		writeLimitHeaders(w, result)
+	} else if !result.allowed {
+		w.Header().Set("Retry-After", "1")
+	}
+	if !result.allowed {
+		http.Error(w, fmt.Sprintf("%s: %s", toolID, result.reason), http.StatusTooManyRequests)
+		return nil, false
+	}
+	return release, true
+}
+
+// AcquireTool 实现core.ToolLimiter，未启用认证时所有非HTTP调用共享一个限流标识
+func (s *Server) AcquireTool(toolID string, caller *core.Caller) (func(), error) {
+	key := "internal"
+	if caller != nil {
+		key = caller.ID
+	}
+	release, result := s.acquireTool(toolID, key)
+	if !result.allowed {
+		return nil, fmt.Errorf("%s: %s", toolID, result.reason)
+	}
+	return release, nil
+}
@@ -4,30 +4,60 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"gay/plugintools/internal/audit"
+	"gay/plugintools/internal/auth"
+	"gay/plugintools/internal/config"
 	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+	"gay/plugintools/internal/secrets"
 )
 
 // Server represents the HTTP server for the tools platform
 type Server struct {
-	registry core.ToolRegistry
+	registry  core.ToolRegistry
+	limiter   *limiter
+	audit     *audit.Log
+	approvals *approvalStore
 }
 
 // NewServer creates a new server instance
 func NewServer(registry core.ToolRegistry) *Server {
 	return &Server{
-		registry: registry,
+		registry:  registry,
+		limiter:   newLimiter(),
+		approvals: newApprovalStore(),
 	}
 }
 
 // Start starts the HTTP server
 func (s *Server) Start(addr string) error {
 	// Register routes with middleware
-	http.HandleFunc("/api/v1/tools", Chain(s.handleTools, Logger, Auth))
-	http.HandleFunc("/api/v1/tools/", Chain(s.handleToolOperation, Logger, Auth))
+	http.HandleFunc("/api/v1/tools", Chain(s.handleTools, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/tools/", Chain(s.handleToolOperation, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/admin/keys", Chain(s.handleAdminKeys, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/admin/keys/", Chain(s.handleAdminKeys, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/audit", Chain(s.handleAudit, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/audit/verify", Chain(s.handleAudit, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/approvals", Chain(s.handleApprovals, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/approvals/", Chain(s.handleApprovals, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/policies", Chain(s.handlePolicies, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+	http.HandleFunc("/api/v1/policies/evaluate", Chain(s.handlePolicies, s.RateLimit, Logger, Auth, Signature, s.ClientLimit))
+
+	if !config.Get().Server.TLS.Enabled {
+		fmt.Printf("Server starting on %s\n", addr)
+		return http.ListenAndServe(addr, nil)
+	}
 
-	fmt.Printf("Server starting on %s\n", addr)
-	return http.ListenAndServe(addr, nil)
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Addr: addr, TLSConfig: tlsConfig}
+	fmt.Printf("Server starting on %s (TLS)\n", addr)
+	return httpServer.ListenAndServeTLS("", "")
 }
 
 // handleTools handles GET /api/v1/tools
@@ -37,9 +67,14 @@ func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only list tools the caller has been granted at least one operation on
+	caller := core.CallerFromContext(r.Context())
 	tools := s.registry.List()
 	toolInfos := make([]core.ToolInfo, 0, len(tools))
 	for _, tool := range tools {
+		if !auth.CanSee(caller, tool.GetInfo().ID) {
+			continue
+		}
 		toolInfos = append(toolInfos, tool.GetInfo())
 	}
 
@@ -48,15 +83,21 @@ func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
 
 // handleToolOperation handles operations on specific tools
 func (s *Server) handleToolOperation(w http.ResponseWriter, r *http.Request) {
-	toolID := r.URL.Path[len("/api/v1/tools/"):]
+	toolID, subPath, _ := strings.Cut(r.URL.Path[len("/api/v1/tools/"):], "/")
 	if toolID == "" {
 		http.Error(w, "Tool ID required", http.StatusBadRequest)
 		return
 	}
 
 	tool, err := s.registry.Get(toolID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err != nil || !auth.CanSee(core.CallerFromContext(r.Context()), toolID) {
+		// Tools the caller cannot use are reported as missing so their existence is not revealed
+		http.Error(w, fmt.Sprintf("tool with ID %s not found", toolID), http.StatusNotFound)
+		return
+	}
+
+	if subPath != "" {
+		s.handleToolRoute(w, r, tool, subPath)
 		return
 	}
 
@@ -74,11 +115,70 @@ func (s *Server) handleToolOperation(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleToolRoute dispatches requests to extra endpoints exposed by a tool
+func (s *Server) handleToolRoute(w http.ResponseWriter, r *http.Request, tool core.Tool, subPath string) {
+	provider, ok := tool.(core.RouteProvider)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	handler, ok := provider.Routes()[subPath]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	start := time.Now()
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	params := make(map[string]interface{})
+	for name := range r.URL.Query() {
+		params[name] = r.URL.Query().Get(name)
+	}
+	defer func() {
+		s.recordAudit(r, tool.GetInfo().ID, subPath, params, rw.status, "", nil, start)
+	}()
+
+	// Extra endpoints are authorized as an operation named after the sub-path
+	if !auth.Authorize(core.CallerFromContext(r.Context()), tool.GetInfo().ID, subPath) {
+		http.Error(rw, fmt.Sprintf("operation %s is not permitted", subPath), http.StatusForbidden)
+		return
+	}
+	decision := policy.Check(policy.Input{Caller: core.CallerFromContext(r.Context()), ToolID: tool.GetInfo().ID, Operation: subPath, Params: params})
+	if !decision.Allowed {
+		http.Error(rw, fmt.Sprintf("denied by policy %s: %s", decision.Policy, decision.Reason), http.StatusForbidden)
+		return
+	}
+	if auth.RequiresApproval(tool, subPath, params) {
+		http.Error(rw, fmt.Sprintf("operation %s requires approval and cannot be used through this endpoint", subPath), http.StatusForbidden)
+		return
+	}
+
+	release, ok := s.limitTool(rw, r, tool.GetInfo().ID)
+	if !ok {
+		return
+	}
+	defer release()
+	handler(rw, r)
+}
+
 // handleToolExecution handles tool execution
 func (s *Server) handleToolExecution(w http.ResponseWriter, r *http.Request, tool core.Tool) {
+	start := time.Now()
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 	var params map[string]interface{}
+	var operation, errMsg string
+	var result interface{}
+	defer func() {
+		s.recordAudit(r, tool.GetInfo().ID, operation, params, rw.status, errMsg, result, start)
+	}()
+	fail := func(msg string, status int) {
+		errMsg = secrets.Redact(msg)
+		http.Error(rw, errMsg, status)
+	}
+
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		fail("Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -86,15 +186,52 @@ func (s *Server) handleToolExecution(w http.ResponseWriter, r *http.Request, too
 	for _, param := range tool.GetParams() {
 		if param.Required {
 			if _, exists := params[param.Name]; !exists {
-				http.Error(w, fmt.Sprintf("Missing required parameter: %s", param.Name), http.StatusBadRequest)
+				fail(fmt.Sprintf("Missing required parameter: %s", param.Name), http.StatusBadRequest)
 				return
 			}
 		}
 	}
 
-	result, err := tool.Execute(params)
+	// Authorize the operation before the tool runs
+	operation = auth.Operation(tool, params)
+	if !auth.Authorize(core.CallerFromContext(r.Context()), tool.GetInfo().ID, operation) {
+		fail(fmt.Sprintf("operation %s is not permitted", operation), http.StatusForbidden)
+		return
+	}
+
+	// Conditional policies are evaluated against the resolved operation and params
+	decision := policy.Check(policy.Input{Caller: core.CallerFromContext(r.Context()), ToolID: tool.GetInfo().ID, Operation: operation, Params: params})
+	if !decision.Allowed {
+		fail(fmt.Sprintf("denied by policy %s: %s", decision.Policy, decision.Reason), http.StatusForbidden)
+		return
+	}
+
+	// Park calls matching an approval rule until an approver decides on them
+	if auth.RequiresApproval(tool, operation, params) {
+		a := s.requestApproval(rw, r, tool, operation, params)
+		result = map[string]interface{}{"approval_id": a.ID, "status": "pending"}
+		return
+	}
+
+	release, ok := s.limitTool(rw, r, tool.GetInfo().ID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Secret references are resolved last so that audit records, policies and approvals only see the references
+	execParams, err := auth.ResolveSecrets(core.CallerFromContext(r.Context()), params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		fail(err.Error(), http.StatusForbidden)
+		return
+	}
+	if ct, ok := tool.(core.ContextTool); ok {
+		result, err = ct.ExecuteContext(core.WithUnresolvedParams(r.Context(), params), execParams)
+	} else {
+		result, err = tool.Execute(execParams)
+	}
+	if err != nil {
+		fail(err.Error(), http.StatusInternalServerError)
 		return
 	}
 
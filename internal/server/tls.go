@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+)
+
+// tlsReloadInterval 两次检查证书文件是否变更之间的最小间隔
+const tlsReloadInterval = 5 * time.Second
+
+// tlsReloader 在握手时提供证书和客户端CA，文件变更后自动重新加载，加载失败时继续使用旧的证书
+type tlsReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  [3]time.Time
+	checkedAt time.Time
+}
+
+// newTLSConfig 根据配置创建TLS配置
+func newTLSConfig() (*tls.Config, error) {
+	cfg := config.Get().Server.TLS
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("tls: cert_file and key_file are required")
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("tls: unsupported min_version %s", cfg.MinVersion)
+	}
+
+	clientAuth := tls.NoClientCert
+	switch cfg.ClientAuth {
+	case "", "none":
+	case "optional":
+		clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("tls: unsupported client_auth %s", cfg.ClientAuth)
+	}
+	if clientAuth != tls.NoClientCert && cfg.ClientCA == "" {
+		return nil, fmt.Errorf("tls: client_ca is required when client_auth is %s", cfg.ClientAuth)
+	}
+
+	r := &tlsReloader{certFile: cfg.CertFile, keyFile: cfg.KeyFile, caFile: cfg.ClientCA}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: minVersion,
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	return &tls.Config{
+		MinVersion: minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, clientCAs := r.current()
+			c := base.Clone()
+			c.Certificates = []tls.Certificate{*cert}
+			c.ClientCAs = clientCAs
+			return c, nil
+		},
+	}, nil
+}
+
+// current 返回当前的证书和客户端CA，必要时先重新加载
+func (r *tlsReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= tlsReloadInterval {
+		r.checkedAt = time.Now()
+		if r.changed() {
+			if err := r.loadLocked(); err != nil {
+				log.Printf("tls: failed to reload certificates, keeping the previous ones: %v", err)
+			} else {
+				log.Printf("tls: reloaded certificates")
+			}
+		}
+	}
+	return r.cert, r.clientCAs
+}
+
+// changed 检查证书、私钥或CA文件的修改时间是否变化
+func (r *tlsReloader) changed() bool {
+	for i, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err == nil && !info.ModTime().Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// load 加载证书、私钥和客户端CA
+func (r *tlsReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+	return r.loadLocked()
+}
+
+func (r *tlsReloader) loadLocked() error {
+	var modTimes [3]time.Time
+	for i, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: failed to load certificate: %v", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("tls: failed to read client CA: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
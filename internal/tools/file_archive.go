@@ -0,0 +1,584 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"gay/plugintools/internal/config"
+)
+
+// 支持的归档格式
+const (
+	archiveZip    = "zip"
+	archiveTar    = "tar"
+	archiveTarGz  = "tar.gz"
+	archiveTarZst = "tar.zst"
+)
+
+// defaultMaxArchiveEntries 未配置时允许的最大归档条目数
+const defaultMaxArchiveEntries = 10000
+
+// archiveLimits 归档操作的大小和条目数限制
+type archiveLimits struct {
+	maxBytes   int64
+	maxEntries int
+}
+
+// getArchiveLimits 从配置中读取归档限制
+func getArchiveLimits() archiveLimits {
+	cfg := config.Get().Tools.FileManager
+	limits := archiveLimits{
+		maxBytes:   cfg.MaxFileSize,
+		maxEntries: cfg.MaxArchiveEntries,
+	}
+	if limits.maxEntries <= 0 {
+		limits.maxEntries = defaultMaxArchiveEntries
+	}
+	return limits
+}
+
+// detectArchiveFormat 根据显式格式或文件扩展名确定归档格式
+func detectArchiveFormat(path, format string) (string, error) {
+	if format == "" {
+		lower := strings.ToLower(path)
+		switch {
+		case strings.HasSuffix(lower, ".zip"):
+			format = archiveZip
+		case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+			format = archiveTarGz
+		case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+			format = archiveTarZst
+		case strings.HasSuffix(lower, ".tar"):
+			format = archiveTar
+		default:
+			return "", fmt.Errorf("cannot detect archive format of %s, specify format parameter", path)
+		}
+	}
+
+	switch format {
+	case archiveZip, archiveTar, archiveTarGz, archiveTarZst:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+// archiveEntry 待归档的文件系统条目
+type archiveEntry struct {
+	path string
+	name string
+	info fs.FileInfo
+	link string
+}
+
+// collectArchiveEntries 遍历源路径并检查大小和条目数限制
+func collectArchiveEntries(src string, limits archiveLimits) ([]archiveEntry, int64, error) {
+	base := filepath.Dir(src)
+	var entries []archiveEntry
+	var total int64
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		entry := archiveEntry{path: path, name: filepath.ToSlash(rel), info: info}
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if entry.link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case info.IsDir():
+			entry.name += "/"
+		case info.Mode().IsRegular():
+			total += info.Size()
+			if total > limits.maxBytes {
+				return fmt.Errorf("archive content exceeds maximum allowed size of %d bytes", limits.maxBytes)
+			}
+		default:
+			// 跳过设备文件、管道等特殊文件
+			return nil
+		}
+
+		entries = append(entries, entry)
+		if len(entries) > limits.maxEntries {
+			return fmt.Errorf("archive exceeds maximum of %d entries", limits.maxEntries)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// archive 将文件或目录打包为归档文件
+func (fm *FileManager) archive(src, dst, format string) (map[string]interface{}, error) {
+	format, err := detectArchiveFormat(dst, format)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, total, err := collectArchiveEntries(src, getArchiveLimits())
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == archiveZip {
+		err = writeZip(out, entries)
+	} else {
+		err = writeTar(out, entries, format)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"path":    dst,
+		"format":  format,
+		"entries": len(entries),
+		"bytes":   total,
+	}, nil
+}
+
+// writeZip 写入zip归档
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		header, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.name
+		if entry.info.Mode().IsRegular() {
+			header.Method = zip.Deflate
+		}
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.link != "":
+			_, err = io.WriteString(writer, entry.link)
+		case entry.info.Mode().IsRegular():
+			err = copyFileContent(writer, entry.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTar 写入tar归档，按格式选择压缩方式
+func writeTar(w io.Writer, entries []archiveEntry, format string) error {
+	var compressor io.WriteCloser
+	switch format {
+	case archiveTarGz:
+		compressor = gzip.NewWriter(w)
+	case archiveTarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		compressor = zw
+	}
+	if compressor != nil {
+		w = compressor
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		header, err := tar.FileInfoHeader(entry.info, entry.link)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.name
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.info.Mode().IsRegular() {
+			if err := copyFileContent(tw, entry.path); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		return compressor.Close()
+	}
+	return nil
+}
+
+// copyFileContent 将文件内容写入writer
+func copyFileContent(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// extractor 解压时的状态，负责路径校验和限制统计
+type extractor struct {
+	root     string // 解压目录的真实路径
+	limits   archiveLimits
+	symlinks bool // 是否解压符号链接，关闭时跳过归档中的符号链接
+	entries  int
+	written  int64
+	skipped  int
+}
+
+// target 计算条目的目标路径并防止zip-slip
+func (e *extractor) target(name string) (string, error) {
+	e.entries++
+	if e.entries > e.limits.maxEntries {
+		return "", fmt.Errorf("archive exceeds maximum of %d entries", e.limits.maxEntries)
+	}
+
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("illegal absolute path in archive: %s", name)
+	}
+	target := filepath.Join(e.root, filepath.FromSlash(name))
+	if target == e.root || !isSubPath(e.root, target) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return target, nil
+}
+
+// checkReal 确认路径解析符号链接后仍位于解压目录内
+func (e *extractor) checkReal(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !isSubPath(e.root, resolved) {
+		return "", fmt.Errorf("illegal path in archive: %s resolves outside the extraction directory", path)
+	}
+	return resolved, nil
+}
+
+// mkdirAll 在解压目录内逐级创建目录，路径中的符号链接（包括同一归档中先前创建的）按真实路径检查，
+// 避免MkdirAll或之后的写入经由符号链接落到解压目录外
+func (e *extractor) mkdirAll(dir string) error {
+	rel, err := filepath.Rel(e.root, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("illegal path in archive: %s", dir)
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := e.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if err := os.Mkdir(current, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&fs.ModeSymlink != 0:
+			if _, err := e.checkReal(current); err != nil {
+				return err
+			}
+		case !info.IsDir():
+			return fmt.Errorf("illegal path in archive: %s is not a directory", current)
+		}
+	}
+	return nil
+}
+
+// checkLink 确认符号链接的目标位于解压目录内，相对目标按链接所在目录的真实路径计算
+func (e *extractor) checkLink(target, linkname string) error {
+	resolved := filepath.Clean(linkname)
+	if !filepath.IsAbs(linkname) {
+		parent, err := e.checkReal(filepath.Dir(target))
+		if err != nil {
+			return err
+		}
+		resolved = filepath.Join(parent, filepath.FromSlash(linkname))
+	}
+	if !isSubPath(e.root, resolved) {
+		return fmt.Errorf("illegal link target in archive: %s -> %s", target, linkname)
+	}
+	return nil
+}
+
+// symlink 创建符号链接，未启用symlinks时跳过
+func (e *extractor) symlink(target, linkname string) error {
+	if !e.symlinks {
+		e.skipped++
+		return nil
+	}
+	if err := e.prepare(target); err != nil {
+		return err
+	}
+	if err := e.checkLink(target, linkname); err != nil {
+		return err
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		return err
+	}
+	// 目标已存在时再按真实路径检查一次，经由其他链接的 ".." 可能与字面路径不同
+	if _, err := os.Stat(target); err == nil {
+		if _, err := e.checkReal(target); err != nil {
+			os.Remove(target)
+			return err
+		}
+	}
+	return nil
+}
+
+// hardlink 创建硬链接，源文件按真实路径检查且必须是普通文件
+func (e *extractor) hardlink(target, linkname string) error {
+	source := filepath.Join(e.root, filepath.FromSlash(linkname))
+	if filepath.IsAbs(linkname) || !isSubPath(e.root, source) {
+		return fmt.Errorf("illegal link target in archive: %s -> %s", target, linkname)
+	}
+	resolved, err := e.checkReal(source)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(resolved)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("illegal link target in archive: %s is not a regular file", linkname)
+	}
+	if err := e.prepare(target); err != nil {
+		return err
+	}
+	return os.Link(resolved, target)
+}
+
+// prepare 在解压目录内创建父目录并移除已存在的符号链接，避免写入被重定向
+func (e *extractor) prepare(target string) error {
+	if err := e.mkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return os.Remove(target)
+	}
+	return nil
+}
+
+// writeFile 写入普通文件，按实际写入字节数统计大小限制
+func (e *extractor) writeFile(target string, r io.Reader, mode fs.FileMode) error {
+	if err := e.prepare(target); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	remaining := e.limits.maxBytes - e.written
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	e.written += n
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		return fmt.Errorf("extracted content exceeds maximum allowed size of %d bytes", e.limits.maxBytes)
+	}
+	return nil
+}
+
+// extract 将归档文件解压到目标目录，symlinks为false时跳过归档中的符号链接
+func (fm *FileManager) extract(src, dst, format string, symlinks bool) (map[string]interface{}, error) {
+	format, err := detectArchiveFormat(src, format)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+
+	e := &extractor{root: root, limits: getArchiveLimits(), symlinks: symlinks}
+	if format == archiveZip {
+		err = e.extractZip(src)
+	} else {
+		err = e.extractTar(src, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"path":             dst,
+		"format":           format,
+		"entries":          e.entries,
+		"bytes":            e.written,
+		"skipped_symlinks": e.skipped,
+	}, nil
+}
+
+// extractZip 解压zip归档
+func (e *extractor) extractZip(src string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	if len(zr.File) > e.limits.maxEntries {
+		return fmt.Errorf("archive exceeds maximum of %d entries", e.limits.maxEntries)
+	}
+
+	for _, file := range zr.File {
+		target, err := e.target(file.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.mkdirAll(target)
+		case mode&fs.ModeSymlink != 0:
+			err = e.extractZipSymlink(file, target)
+		case mode.IsRegular():
+			err = e.extractZipFile(file, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipFile 解压zip中的普通文件
+func (e *extractor) extractZipFile(file *zip.File, target string) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return e.writeFile(target, rc, file.Mode())
+}
+
+// extractZipSymlink 解压zip中的符号链接
+func (e *extractor) extractZipSymlink(file *zip.File, target string) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	linkname, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return e.symlink(target, string(linkname))
+}
+
+// extractTar 解压tar归档，按格式选择解压缩方式
+func (e *extractor) extractTar(src, format string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch format {
+	case archiveTarGz:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case archiveTarZst:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := e.target(header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.mkdirAll(target)
+		case tar.TypeReg:
+			err = e.writeFile(target, tr, header.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = e.symlink(target, header.Linkname)
+		case tar.TypeLink:
+			err = e.hardlink(target, header.Linkname)
+		default:
+			// 忽略设备文件、管道等特殊条目
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
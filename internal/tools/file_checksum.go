@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/zeebo/blake3"
+
+	"gay/plugintools/internal/config"
+)
+
+// newHasher 根据算法名称创建哈希函数
+func newHasher(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "", "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "blake3":
+		return blake3.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+}
+
+// hashFile 计算单个文件的哈希，不跟随符号链接
+func hashFile(path, algorithm string) (string, error) {
+	h, err := newHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|openNoFollow, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksum 计算文件或目录树的哈希
+// 目录树的整体哈希由按路径排序的 "哈希  相对路径" 行计算得出，与 sha256sum 输出格式一致
+func (fm *FileManager) checksum(path string, params map[string]interface{}) (map[string]interface{}, error) {
+	algorithm, _ := params["algorithm"].(string)
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	if _, err := newHasher(algorithm); err != nil {
+		return nil, err
+	}
+
+	// 按真实路径计算，目录树中的符号链接不跟随
+	real, err := resolveAllowedPath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := config.Get().Tools.FileManager.MaxTreeSize
+	if maxSize <= 0 {
+		maxSize = config.Get().Tools.FileManager.MaxFileSize
+	}
+
+	if !info.IsDir() {
+		if info.Size() > maxSize {
+			return nil, fmt.Errorf("file size exceeds maximum allowed size of %d bytes", maxSize)
+		}
+		sum, err := hashFile(real, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"path":      path,
+			"algorithm": algorithm,
+			"checksum":  sum,
+			"size":      info.Size(),
+		}, nil
+	}
+
+	tree, _ := newHasher(algorithm)
+	files := make(map[string]string)
+	var total int64
+
+	// WalkDir按字典序遍历，保证整体哈希稳定
+	err = filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		if total > maxSize {
+			return fmt.Errorf("total size exceeds maximum allowed size of %d bytes", maxSize)
+		}
+
+		sum, err := hashFile(p, algorithm)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(real, p)
+		rel = filepath.ToSlash(rel)
+		files[rel] = sum
+		io.WriteString(tree, sum+"  "+rel+"\n")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"path":      path,
+		"algorithm": algorithm,
+		"checksum":  hex.EncodeToString(tree.Sum(nil)),
+		"size":      total,
+		"files":     files,
+	}, nil
+}
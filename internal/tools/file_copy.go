@@ -0,0 +1,399 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"gay/plugintools/internal/config"
+)
+
+// 目标已存在时的冲突处理策略
+const (
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+	conflictRename    = "rename"
+)
+
+// copyOptions 复制和移动操作的选项
+type copyOptions struct {
+	conflict string
+	preserve bool
+}
+
+// copyFailure 记录单个条目的失败原因
+type copyFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// copyReport 复制或移动操作的结果
+type copyReport struct {
+	Source      string        `json:"source"`
+	Destination string        `json:"destination"`
+	Method      string        `json:"method"` // copy, rename, copy+delete, skip
+	Copied      int           `json:"copied"`
+	Bytes       int64         `json:"bytes"`
+	Skipped     []string      `json:"skipped,omitempty"`
+	Failed      []copyFailure `json:"failed,omitempty"`
+}
+
+// fail 记录一个条目失败
+func (r *copyReport) fail(path string, err error) {
+	r.Failed = append(r.Failed, copyFailure{Path: path, Error: err.Error()})
+}
+
+// parseCopyOptions 从参数中解析复制选项
+func parseCopyOptions(params map[string]interface{}) (copyOptions, error) {
+	opts := copyOptions{conflict: conflictOverwrite}
+	if conflict, ok := params["conflict"].(string); ok && conflict != "" {
+		switch conflict {
+		case conflictOverwrite, conflictSkip, conflictRename:
+			opts.conflict = conflict
+		default:
+			return opts, fmt.Errorf("unsupported conflict policy: %s", conflict)
+		}
+	}
+	opts.preserve, _ = params["preserve"].(bool)
+	return opts, nil
+}
+
+// resolveConflict 按策略处理已存在的目标，返回实际目标路径；skip为true表示跳过
+func resolveConflict(dst, policy string) (string, bool, error) {
+	if _, err := os.Lstat(dst); err != nil {
+		if os.IsNotExist(err) {
+			return dst, false, nil
+		}
+		return "", false, err
+	}
+
+	switch policy {
+	case conflictSkip:
+		return dst, true, nil
+	case conflictRename:
+		name, err := availableName(dst)
+		return name, false, err
+	default:
+		return dst, false, nil
+	}
+}
+
+// availableName 生成一个不存在的同目录文件名，如 report_1.txt
+func availableName(path string) (string, error) {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	if strings.HasSuffix(base, ".tar"+ext) {
+		ext = ".tar" + ext
+	}
+	stem := strings.TrimSuffix(base, ext)
+
+	for i := 1; i < 10000; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", stem, i, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find an available name for %s", path)
+}
+
+// checkTreeSize 检查单个文件和整个目录树的大小限制，与copyEntry一样不跟随符号链接
+func checkTreeSize(src string) error {
+	cfg := config.Get().Tools.FileManager
+	maxTree := cfg.MaxTreeSize
+	if maxTree <= 0 {
+		maxTree = cfg.MaxFileSize
+	}
+
+	var total int64
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		if info.Size() > cfg.MaxFileSize {
+			return fmt.Errorf("file %s exceeds maximum allowed size of %d bytes", path, cfg.MaxFileSize)
+		}
+		total += info.Size()
+		if total > maxTree {
+			return fmt.Errorf("total size exceeds maximum allowed size of %d bytes", maxTree)
+		}
+		return nil
+	})
+}
+
+// copy 复制文件或目录
+func (fm *FileManager) copy(src, dst string, opts copyOptions) (*copyReport, error) {
+	report := &copyReport{Source: src, Destination: dst, Method: "copy"}
+
+	if err := fm.prepareCopy(src, dst); err != nil {
+		return nil, err
+	}
+
+	dst, skip, err := resolveConflict(dst, opts.conflict)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		report.Method = "skip"
+		report.Skipped = append(report.Skipped, dst)
+		return report, nil
+	}
+	report.Destination = dst
+
+	fm.copyEntry(src, dst, opts, report)
+	return report, nil
+}
+
+// prepareCopy 校验源路径、防止复制到自身子目录并检查大小限制
+func (fm *FileManager) prepareCopy(src, dst string) error {
+	sourceInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if sourceInfo.IsDir() {
+		absSrc, _ := filepath.Abs(src)
+		absDst, _ := filepath.Abs(dst)
+		if isSubPath(absSrc, absDst) {
+			return fmt.Errorf("cannot copy directory %s into itself", src)
+		}
+	}
+
+	return checkTreeSize(src)
+}
+
+// copyEntry 递归复制单个条目，失败记录到报告中而不中断整个操作
+// 符号链接总是作为链接复制，不跟随，避免链接成环或把允许路径之外的内容复制进来
+func (fm *FileManager) copyEntry(src, dst string, opts copyOptions, report *copyReport) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		report.fail(src, err)
+		return
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		err = copySymlink(src, dst)
+	case info.IsDir():
+		err = fm.copyDir(src, dst, info, opts, report)
+	case info.Mode().IsRegular():
+		var n int64
+		if n, err = copyFile(src, dst, info, opts.preserve); err == nil {
+			report.Bytes += n
+		}
+	default:
+		err = fmt.Errorf("unsupported file type %s", info.Mode().Type())
+	}
+
+	if err != nil {
+		report.fail(src, err)
+		return
+	}
+	report.Copied++
+}
+
+// copyDir 复制目录，目标已存在时合并内容
+func (fm *FileManager) copyDir(src, dst string, info fs.FileInfo, opts copyOptions, report *copyReport) error {
+	if existing, err := os.Lstat(dst); err == nil && !existing.IsDir() {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fm.copyEntry(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), opts, report)
+	}
+
+	if opts.preserve {
+		return preserveMetadata(dst, info)
+	}
+	return nil
+}
+
+// copyFile 复制单个文件
+func copyFile(src, dst string, info fs.FileInfo, preserve bool) (int64, error) {
+	source, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	// 不跟随目标位置已有的符号链接
+	if existing, err := os.Lstat(dst); err == nil && !existing.Mode().IsRegular() {
+		if err := os.RemoveAll(dst); err != nil {
+			return 0, err
+		}
+	}
+
+	perm := fs.FileMode(0644)
+	if preserve {
+		perm = info.Mode().Perm()
+	}
+	destination, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if preserve {
+		return n, preserveMetadata(dst, info)
+	}
+	return n, nil
+}
+
+// copySymlink 复制符号链接本身而不是其指向的内容
+// 相对目标在新位置可能指向别处，按目标目录解析后仍须位于允许路径内
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	if err := checkLinkTarget(dir, target); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, dst)
+}
+
+// checkLinkTarget 检查位于真实目录dir中、指向target的符号链接是否指向允许路径之内
+// 目标已存在时再按真实路径检查一次，经由其他链接的 ".." 可能与字面路径不同
+func checkLinkTarget(dir, target string) error {
+	resolved := filepath.Clean(target)
+	if !filepath.IsAbs(target) {
+		resolved = filepath.Join(dir, target)
+	}
+	if !isAllowedRealPath(resolved) {
+		return fmt.Errorf("symlink target %s resolves outside allowed paths", target)
+	}
+	if real, err := filepath.EvalSymlinks(resolved); err == nil && !isAllowedRealPath(real) {
+		return fmt.Errorf("symlink target %s resolves outside allowed paths", target)
+	}
+	return nil
+}
+
+// checkMovedLinks 检查src（及其下所有条目）中的符号链接移动到dst之后是否仍指向允许路径之内
+func checkMovedLinks(src, dst string) error {
+	parent, err := filepath.EvalSymlinks(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(parent, filepath.Base(dst))
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if err := checkLinkTarget(filepath.Dir(filepath.Join(base, rel)), target); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// preserveMetadata 保留权限位和修改时间
+func preserveMetadata(path string, info fs.FileInfo) error {
+	if err := os.Chmod(path, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
+
+// move 移动文件或目录，跨文件系统时回退为复制后删除
+func (fm *FileManager) move(src, dst string, opts copyOptions) (*copyReport, error) {
+	report := &copyReport{Source: src, Destination: dst, Method: "rename"}
+
+	if _, err := os.Lstat(src); err != nil {
+		return nil, err
+	}
+
+	dst, skip, err := resolveConflict(dst, opts.conflict)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		report.Method = "skip"
+		report.Skipped = append(report.Skipped, dst)
+		return report, nil
+	}
+	report.Destination = dst
+
+	// 目标是已存在的目录时，rename无法覆盖，需要合并
+	merge := false
+	if existing, err := os.Lstat(dst); err == nil && existing.IsDir() {
+		merge = true
+	}
+
+	if !merge {
+		// 重命名会原样保留链接，需先检查相对目标在新位置的指向
+		if err := checkMovedLinks(src, dst); err != nil {
+			return nil, err
+		}
+		err := os.Rename(src, dst)
+		if err == nil {
+			report.Copied = 1
+			return report, nil
+		}
+		if !errors.Is(err, syscall.EXDEV) {
+			return nil, err
+		}
+	}
+
+	// 跨设备或合并目录：复制后删除源，始终保留元数据
+	opts.preserve = true
+	if err := fm.prepareCopy(src, dst); err != nil {
+		return nil, err
+	}
+	report.Method = "copy+delete"
+	fm.copyEntry(src, dst, opts, report)
+
+	if len(report.Failed) > 0 {
+		return report, nil
+	}
+	if err := os.RemoveAll(src); err != nil {
+		report.fail(src, err)
+	}
+	return report, nil
+}
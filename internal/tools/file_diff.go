@@ -0,0 +1,606 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gay/plugintools/internal/config"
+)
+
+const (
+	// diffContext 统一diff中每个hunk前后的上下文行数
+	diffContext = 3
+	// maxDiffEdits 编辑距离上限，计算时间与行数和编辑距离的乘积成正比，超过时放弃计算
+	maxDiffEdits = 10000
+	// noNewlineMarker 统一diff中表示文件末尾没有换行符
+	noNewlineMarker = "\\ No newline at end of file"
+)
+
+// splitLines 按行切分文本，每行保留结尾的换行符，便于识别末尾缺少换行的情况
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// readTextFile 按真实路径检查后读取文件内容并检查大小限制
+func readTextFile(path string) (string, error) {
+	f, err := openAllowed(path, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	maxSize := config.Get().Tools.FileManager.MaxFileSize
+	if info.Size() > maxSize {
+		return "", fmt.Errorf("file size exceeds maximum allowed size of %d bytes", maxSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > maxSize {
+		return "", fmt.Errorf("file size exceeds maximum allowed size of %d bytes", maxSize)
+	}
+	return string(data), nil
+}
+
+// diffOp 编辑脚本中的一步：' ' 相同，'-' 删除，'+' 插入
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// differ 线性空间的Myers算法，通过中间蛇分治，内存占用与行数成正比
+type differ struct {
+	a, b   []string
+	vf, vb []int // 正向和反向搜索在每条对角线上到达的x
+	offset int
+	ops    []diffOp
+}
+
+// myersDiff 使用Myers算法计算两组行之间的最短编辑脚本
+func myersDiff(a, b []string) ([]diffOp, error) {
+	// 反向搜索的对角线以两侧行数差为中心，范围最多为行数之和的1.5倍
+	size := 2*(len(a)+len(b)) + 2
+	d := &differ{
+		a:      a,
+		b:      b,
+		vf:     make([]int, 2*size+1),
+		vb:     make([]int, 2*size+1),
+		offset: size,
+	}
+	if err := d.compare(0, len(a), 0, len(b)); err != nil {
+		return nil, err
+	}
+	return groupChanges(d.ops), nil
+}
+
+// compare 计算a[a0:a1]和b[b0:b1]之间的编辑脚本并追加到ops
+func (d *differ) compare(a0, a1, b0, b1 int) error {
+	// 去掉相同的前缀和后缀
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, diffOp{kind: ' ', a: a0, b: b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-suffix-1] == d.b[b1-suffix-1] {
+		suffix++
+	}
+	a1 -= suffix
+	b1 -= suffix
+
+	switch {
+	case a0 == a1:
+		for ; b0 < b1; b0++ {
+			d.ops = append(d.ops, diffOp{kind: '+', a: a0, b: b0})
+		}
+	case b0 == b1:
+		for ; a0 < a1; a0++ {
+			d.ops = append(d.ops, diffOp{kind: '-', a: a0, b: b0})
+		}
+	default:
+		x, y, u, v, err := d.middleSnake(a0, a1, b0, b1)
+		if err != nil {
+			return err
+		}
+		if err := d.compare(a0, x, b0, y); err != nil {
+			return err
+		}
+		for ; x < u; x, y = x+1, y+1 {
+			d.ops = append(d.ops, diffOp{kind: ' ', a: x, b: y})
+		}
+		if err := d.compare(u, a1, v, b1); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.ops = append(d.ops, diffOp{kind: ' ', a: a1 + i, b: b1 + i})
+	}
+	return nil
+}
+
+// middleSnake 同时从两端搜索，返回最短编辑路径中间的一段相同行(x,y)到(u,v)
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int, err error) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	vf, vb, off := d.vf, d.vb, d.offset
+	vf[off+1] = 0
+	vb[off+delta-1] = n
+
+	for step := 0; step <= (n+m+1)/2; step++ {
+		if 2*step > maxDiffEdits {
+			return 0, 0, 0, 0, fmt.Errorf("inputs differ by more than %d edits", maxDiffEdits)
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var px int
+			if k == -step || (k != step && vf[off+k-1] < vf[off+k+1]) {
+				px = vf[off+k+1]
+			} else {
+				px = vf[off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.a[a0+px] == d.b[b0+py] {
+				px++
+				py++
+			}
+			vf[off+k] = px
+			if odd && k >= delta-(step-1) && k <= delta+(step-1) && px >= vb[off+k] {
+				return a0 + sx, b0 + sy, a0 + px, b0 + py, nil
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			kk := k + delta
+			var px int
+			if k == step || (k != -step && vb[off+kk-1] < vb[off+kk+1]) {
+				px = vb[off+kk-1]
+			} else {
+				px = vb[off+kk+1] - 1
+			}
+			py := px - kk
+			ex, ey := px, py
+			for px > 0 && py > 0 && d.a[a0+px-1] == d.b[b0+py-1] {
+				px--
+				py--
+			}
+			vb[off+kk] = px
+			if !odd && kk >= -step && kk <= step && px <= vf[off+kk] {
+				return a0 + px, b0 + py, a0 + ex, b0 + ey, nil
+			}
+		}
+	}
+	return 0, 0, 0, 0, fmt.Errorf("no middle snake found")
+}
+
+// groupChanges 将相邻的删除和插入整理为先删除后插入，使diff更易读
+func groupChanges(ops []diffOp) []diffOp {
+	result := make([]diffOp, 0, len(ops))
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			result = append(result, ops[i])
+			i++
+			continue
+		}
+		j := i
+		var dels, ins []diffOp
+		for ; j < len(ops) && ops[j].kind != ' '; j++ {
+			if ops[j].kind == '-' {
+				dels = append(dels, ops[j])
+			} else {
+				ins = append(ins, ops[j])
+			}
+		}
+		aEnd, bStart := ops[i].a+len(dels), ops[i].b
+		for _, op := range dels {
+			result = append(result, diffOp{kind: '-', a: op.a, b: bStart})
+		}
+		for _, op := range ins {
+			result = append(result, diffOp{kind: '+', a: aEnd, b: op.b})
+		}
+		i = j
+	}
+	return result
+}
+
+// writeDiffLine 输出一行diff，缺少换行的行后附加标记
+func writeDiffLine(sb *strings.Builder, prefix byte, line string) {
+	sb.WriteByte(prefix)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n" + noNewlineMarker + "\n")
+	}
+}
+
+// hunkRange 格式化hunk头中的行范围
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// unifiedDiff 生成统一格式的diff文本，没有差异时返回空字符串
+func unifiedDiff(fromName, toName, from, to string) (string, error) {
+	a, b := splitLines(from), splitLines(to)
+	ops, err := myersDiff(a, b)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(ops); {
+		// 找到下一处变更
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// hunk从变更前diffContext行开始，直到相邻变更间隔超过两倍上下文
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end += min(run-end, diffContext)
+				break
+			}
+			end = run
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		aStart, bStart := ops[start].a, ops[start].b
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+
+		for _, op := range ops[start:end] {
+			switch op.kind {
+			case ' ', '-':
+				writeDiffLine(&sb, op.kind, a[op.a])
+			case '+':
+				writeDiffLine(&sb, op.kind, b[op.b])
+			}
+		}
+		i = end
+	}
+	return sb.String(), nil
+}
+
+// diff 比较path与destination文件或content参数提供的内容
+func (fm *FileManager) diff(path string, params map[string]interface{}) (map[string]interface{}, error) {
+	from, err := readTextFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	toName := "content"
+	var to string
+	if dest, ok := params["destination"].(string); ok && dest != "" {
+		if !fm.isPathAllowed(dest) {
+			return nil, fmt.Errorf("access to destination path %s is not allowed", dest)
+		}
+		if to, err = readTextFile(dest); err != nil {
+			return nil, err
+		}
+		toName = dest
+	} else if content, ok := params["content"].(string); ok {
+		to = content
+	} else {
+		return nil, fmt.Errorf("destination or content parameter is required for diff operation")
+	}
+
+	text, err := unifiedDiff(path, toName, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"changed": text != "",
+		"diff":    text,
+	}, nil
+}
+
+// patchHunk 解析后的一个hunk
+type patchHunk struct {
+	header   string
+	oldStart int
+	oldLines []string
+	newLines []string
+}
+
+// patchConflict 无法应用的hunk
+type patchConflict struct {
+	Hunk   int    `json:"hunk"`
+	Header string `json:"header"`
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// parseHunkRange 解析hunk头中的 "l,s" 行范围，省略行数时为1
+func parseHunkRange(spec string) (start, count int, err error) {
+	startStr, countStr, hasCount := strings.Cut(spec, ",")
+	if start, err = strconv.Atoi(startStr); err != nil {
+		return 0, 0, err
+	}
+	count = 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// parseHunkHeader 解析 "@@ -l,s +l,s @@" 格式的hunk头
+func parseHunkHeader(header string) (oldStart, oldCount, newCount int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[0] != "@@" || fields[3] != "@@" ||
+		!strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	if oldStart, oldCount, err = parseHunkRange(fields[1][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	if _, newCount, err = parseHunkRange(fields[2][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	return oldStart, oldCount, newCount, nil
+}
+
+// parsePatch 解析单文件的统一diff，hunk内容的行数由hunk头决定
+func parsePatch(patch string) ([]*patchHunk, error) {
+	var hunks []*patchHunk
+	var current *patchHunk
+	oldLeft, newLeft := 0, 0
+	// 最近一行内容所属的一侧，用于处理 "\ No newline at end of file"
+	lastOld, lastNew := -1, -1
+	files := 0
+
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if line == noNewlineMarker {
+			if current == nil || (lastOld < 0 && lastNew < 0) {
+				return nil, fmt.Errorf("unexpected %q", noNewlineMarker)
+			}
+			if lastOld >= 0 {
+				current.oldLines[lastOld] = strings.TrimSuffix(current.oldLines[lastOld], "\n")
+			}
+			if lastNew >= 0 {
+				current.newLines[lastNew] = strings.TrimSuffix(current.newLines[lastNew], "\n")
+			}
+			continue
+		}
+
+		if oldLeft > 0 || newLeft > 0 {
+			lastOld, lastNew = -1, -1
+			switch {
+			case line == "" || line[0] == ' ':
+				content := strings.TrimPrefix(line, " ") + "\n"
+				current.oldLines = append(current.oldLines, content)
+				current.newLines = append(current.newLines, content)
+				lastOld, lastNew = len(current.oldLines)-1, len(current.newLines)-1
+				oldLeft--
+				newLeft--
+			case line[0] == '-':
+				current.oldLines = append(current.oldLines, line[1:]+"\n")
+				lastOld = len(current.oldLines) - 1
+				oldLeft--
+			case line[0] == '+':
+				current.newLines = append(current.newLines, line[1:]+"\n")
+				lastNew = len(current.newLines) - 1
+				newLeft--
+			default:
+				return nil, fmt.Errorf("invalid line in hunk %s: %q", current.header, line)
+			}
+			if oldLeft < 0 || newLeft < 0 {
+				return nil, fmt.Errorf("hunk %s has more lines than its header declares", current.header)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			start, oldCount, newCount, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			current = &patchHunk{header: line, oldStart: start}
+			hunks = append(hunks, current)
+			oldLeft, newLeft = oldCount, newCount
+			lastOld, lastNew = -1, -1
+		case strings.HasPrefix(line, "+++ "):
+			files++
+			if files > 1 {
+				return nil, fmt.Errorf("patch contains changes to multiple files")
+			}
+		default:
+			// 忽略文件头和hunk之间的说明文字
+		}
+	}
+
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("hunk %s is truncated", current.header)
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks")
+	}
+	return hunks, nil
+}
+
+// matchAt 检查hunk的旧内容是否与源文件在pos处一致
+func matchAt(lines, old []string, pos int) bool {
+	if pos < 0 || pos+len(old) > len(lines) {
+		return false
+	}
+	for i, line := range old {
+		if lines[pos+i] != line {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPatch 将hunk应用到源文本，任意hunk无法应用时返回冲突列表且不产生结果
+// hunk位置允许偏移，从预期位置向两侧搜索，但不能与前一个hunk重叠
+func applyPatch(source string, hunks []*patchHunk) (string, []patchConflict) {
+	lines := splitLines(source)
+	var out []string
+	var conflicts []patchConflict
+	pos, delta := 0, 0
+
+	for i, h := range hunks {
+		expected := h.oldStart - 1
+		if len(h.oldLines) == 0 {
+			expected = h.oldStart
+		}
+		expected += delta
+
+		at := -1
+		for off := 0; at < 0 && (expected-off >= pos || expected+off <= len(lines)); off++ {
+			if expected+off >= pos && matchAt(lines, h.oldLines, expected+off) {
+				at = expected + off
+			} else if off > 0 && expected-off >= pos && matchAt(lines, h.oldLines, expected-off) {
+				at = expected - off
+			}
+		}
+
+		if at < 0 {
+			conflict := patchConflict{Hunk: i + 1, Header: h.header, Line: expected + 1, Reason: "context does not match"}
+			for j, line := range h.oldLines {
+				if expected+j >= len(lines) {
+					conflict.Reason = "hunk extends beyond end of file"
+					break
+				}
+				if expected+j >= 0 && lines[expected+j] != line {
+					conflict.Line = expected + j + 1
+					conflict.Reason = fmt.Sprintf("expected %q, found %q", strings.TrimSuffix(line, "\n"), strings.TrimSuffix(lines[expected+j], "\n"))
+					break
+				}
+			}
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		out = append(out, lines[pos:at]...)
+		out = append(out, h.newLines...)
+		pos = at + len(h.oldLines)
+		delta = at - (expected - delta)
+	}
+
+	if len(conflicts) > 0 {
+		return "", conflicts
+	}
+	out = append(out, lines[pos:]...)
+	return strings.Join(out, ""), nil
+}
+
+// patch 将统一diff原子地应用到文件，存在冲突时不修改文件
+func (fm *FileManager) patch(path string, params map[string]interface{}) (map[string]interface{}, error) {
+	patchText, ok := params["patch"].(string)
+	if !ok || patchText == "" {
+		return nil, fmt.Errorf("patch parameter is required for patch operation")
+	}
+	dryRun, _ := params["dry_run"].(bool)
+
+	hunks, err := parsePatch(patchText)
+	if err != nil {
+		return nil, err
+	}
+	// 读取和替换都使用真实路径，不会经由符号链接修改允许路径之外的文件
+	real, err := resolveAllowedPath(path)
+	if err != nil {
+		return nil, err
+	}
+	source, err := readTextFile(real)
+	if err != nil {
+		return nil, err
+	}
+
+	result, conflicts := applyPatch(source, hunks)
+	report := map[string]interface{}{
+		"path":      path,
+		"hunks":     len(hunks),
+		"applied":   false,
+		"conflicts": conflicts,
+	}
+	if len(conflicts) > 0 || dryRun {
+		return report, nil
+	}
+
+	if err := writeFileAtomic(real, []byte(result)); err != nil {
+		return nil, err
+	}
+	report["applied"] = true
+	return report, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，保留原文件权限
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".patch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,341 @@
+package tools
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// lcsLength 用动态规划计算最长公共子序列长度，作为最短编辑距离的参照
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+// checkEditScript 检查编辑脚本能还原两侧内容且编辑数最少
+func checkEditScript(t *testing.T, a, b []string, ops []diffOp) {
+	t.Helper()
+	var gotA, gotB []string
+	edits := 0
+	x, y := 0, 0
+	for _, op := range ops {
+		if op.a != x || op.b != y {
+			t.Fatalf("op %c at (%d,%d), expected position (%d,%d)", op.kind, op.a, op.b, x, y)
+		}
+		switch op.kind {
+		case ' ':
+			if a[op.a] != b[op.b] {
+				t.Fatalf("common op joins different lines %q and %q", a[op.a], b[op.b])
+			}
+			gotA = append(gotA, a[op.a])
+			gotB = append(gotB, b[op.b])
+			x++
+			y++
+		case '-':
+			gotA = append(gotA, a[op.a])
+			edits++
+			x++
+		case '+':
+			gotB = append(gotB, b[op.b])
+			edits++
+			y++
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Fatalf("edit script does not reproduce inputs")
+	}
+	if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+		t.Fatalf("edit script has %d edits, shortest has %d", edits, want)
+	}
+}
+
+func TestMyersDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"both empty", "", ""},
+		{"insert all", "", "a\nb\n"},
+		{"delete all", "a\nb\n", ""},
+		{"equal", "a\nb\nc\n", "a\nb\nc\n"},
+		{"replace middle", "a\nb\nc\n", "a\nx\nc\n"},
+		{"insert front", "b\nc\n", "a\nb\nc\n"},
+		{"delete back", "a\nb\nc\n", "a\nb\n"},
+		{"odd delta", "a\nb\nc\nd\ne\n", "b\nx\nd\n"},
+		{"even delta", "a\nb\nc\nd\n", "d\nc\nb\na\n"},
+		{"classic", "a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"no trailing newline", "a\nb", "a\nb\n"},
+		{"repeated lines", "x\nx\nx\ny\nx\n", "y\nx\nx\ny\ny\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := splitLines(tt.a), splitLines(tt.b)
+			ops, err := myersDiff(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEditScript(t, a, b, ops)
+		})
+	}
+}
+
+func TestMyersDiffRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.Intn(4))) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		ops, err := myersDiff(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEditScript(t, a, b, ops)
+	}
+}
+
+func TestMyersDiffMaxEdits(t *testing.T) {
+	a := make([]string, maxDiffEdits)
+	b := make([]string, maxDiffEdits)
+	for i := range a {
+		a[i] = "a\n"
+		b[i] = "b\n"
+	}
+	if _, err := myersDiff(a, b); err == nil {
+		t.Fatal("expected error for inputs exceeding the edit limit")
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		hunks   int
+		oldText string
+		newText string
+		wantErr string
+	}{
+		{
+			name:    "single hunk",
+			patch:   "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			hunks:   1,
+			oldText: "a\nb\n",
+			newText: "a\nc\n",
+		},
+		{
+			name:    "omitted counts",
+			patch:   "@@ -1 +1 @@\n-a\n+b\n",
+			hunks:   1,
+			oldText: "a\n",
+			newText: "b\n",
+		},
+		{
+			name:    "no newline markers",
+			patch:   "@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+			hunks:   1,
+			oldText: "a",
+			newText: "a\n",
+		},
+		{
+			name:    "empty context line",
+			patch:   "@@ -1,2 +1,2 @@\n\n-b\n+c\n",
+			hunks:   1,
+			oldText: "\nb\n",
+			newText: "\nc\n",
+		},
+		{
+			name:    "line starting with hunk marker",
+			patch:   "@@ -1,2 +1,2 @@\n-@@ x\n+--- y\n z\n",
+			hunks:   1,
+			oldText: "@@ x\nz\n",
+			newText: "--- y\nz\n",
+		},
+		{name: "no hunks", patch: "--- a\n+++ b\n", wantErr: "no hunks"},
+		{name: "invalid header", patch: "@@ -x +1 @@\n", wantErr: "invalid hunk header"},
+		{name: "truncated", patch: "@@ -1,2 +1,2 @@\n a\n", wantErr: "truncated"},
+		{name: "too many lines", patch: "@@ -1 +1 @@\n-a\n-b\n+c\n", wantErr: "more lines"},
+		{name: "invalid line", patch: "@@ -1 +1 @@\n*a\n", wantErr: "invalid line"},
+		{name: "multiple files", patch: "+++ a\n@@ -1 +1 @@\n-a\n+b\n+++ b\n", wantErr: "multiple files"},
+		{name: "stray marker", patch: "\\ No newline at end of file\n", wantErr: "unexpected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := parsePatch(tt.patch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hunks) != tt.hunks {
+				t.Fatalf("got %d hunks, want %d", len(hunks), tt.hunks)
+			}
+			if got := strings.Join(hunks[0].oldLines, ""); got != tt.oldText {
+				t.Errorf("old lines = %q, want %q", got, tt.oldText)
+			}
+			if got := strings.Join(hunks[0].newLines, ""); got != tt.newText {
+				t.Errorf("new lines = %q, want %q", got, tt.newText)
+			}
+		})
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		patch     string
+		want      string
+		conflicts int
+	}{
+		{
+			name:   "exact position",
+			source: "a\nb\nc\n",
+			patch:  "@@ -2 +2 @@\n-b\n+x\n",
+			want:   "a\nx\nc\n",
+		},
+		{
+			name:   "shifted down",
+			source: "new\nnew\na\nb\nc\n",
+			patch:  "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+			want:   "new\nnew\na\nx\nc\n",
+		},
+		{
+			name:   "shifted up",
+			source: "b\nc\nd\n",
+			patch:  "@@ -3,2 +3,2 @@\n c\n-d\n+x\n",
+			want:   "b\nc\nx\n",
+		},
+		{
+			name:   "insert into empty file",
+			source: "",
+			patch:  "@@ -0,0 +1,2 @@\n+a\n+b\n",
+			want:   "a\nb\n",
+		},
+		{
+			name:   "insert after line",
+			source: "a\nc\n",
+			patch:  "@@ -1,0 +2 @@\n+b\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "two hunks",
+			source: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			patch:  "@@ -1 +1 @@\n-1\n+one\n@@ -10 +10 @@\n-10\n+ten\n",
+			want:   "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+		},
+		{
+			name:      "context mismatch",
+			source:    "a\nb\nc\n",
+			patch:     "@@ -2 +2 @@\n-q\n+x\n",
+			conflicts: 1,
+		},
+		{
+			name:      "beyond end of file",
+			source:    "a\n",
+			patch:     "@@ -2,2 +2,2 @@\n b\n-c\n+x\n",
+			conflicts: 1,
+		},
+		{
+			name:      "one of two hunks conflicts",
+			source:    "a\nb\nc\n",
+			patch:     "@@ -1 +1 @@\n-a\n+x\n@@ -3 +3 @@\n-z\n+y\n",
+			conflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := parsePatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, conflicts := applyPatch(tt.source, hunks)
+			if len(conflicts) != tt.conflicts {
+				t.Fatalf("got %d conflicts %+v, want %d", len(conflicts), conflicts, tt.conflicts)
+			}
+			if tt.conflicts == 0 && got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffPatchRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{"identical", "a\nb\n", "a\nb\n"},
+		{"from empty", "", "a\nb\n"},
+		{"to empty", "a\nb\n", ""},
+		{"add trailing newline", "a\nb", "a\nb\n"},
+		{"remove trailing newline", "a\nb\n", "a\nb"},
+		{"change last line without newline", "a\nb", "a\nc"},
+		{"distant changes", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\nx\n"},
+		{"lines that look like markers", "--- a\n+++ b\n@@ x\n", "+++ b\n@@ y\n--- a\n"},
+		{"blank lines", "\n\na\n\n", "a\n\n\nb\n"},
+	}
+	rng := rand.New(rand.NewSource(2))
+	randomText := func() string {
+		var sb strings.Builder
+		for i := rng.Intn(40); i > 0; i-- {
+			sb.WriteString(strings.Repeat(string(rune('a'+rng.Intn(3))), rng.Intn(3)))
+			sb.WriteByte('\n')
+		}
+		if rng.Intn(4) == 0 {
+			sb.WriteString("tail")
+		}
+		return sb.String()
+	}
+	for i := 0; i < 200; i++ {
+		tests = append(tests, struct {
+			name     string
+			from, to string
+		}{"random", randomText(), randomText()})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := unifiedDiff("a", "b", tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text == "" {
+				if tt.from != tt.to {
+					t.Fatalf("empty diff for different inputs")
+				}
+				return
+			}
+			hunks, err := parsePatch(text)
+			if err != nil {
+				t.Fatalf("cannot parse generated diff: %v\n%s", err, text)
+			}
+			got, conflicts := applyPatch(tt.from, hunks)
+			if len(conflicts) > 0 {
+				t.Fatalf("conflicts %+v applying generated diff\n%s", conflicts, text)
+			}
+			if got != tt.to {
+				t.Fatalf("round trip got %q, want %q\n%s", got, tt.to, text)
+			}
+		})
+	}
+}
@@ -1,22 +1,35 @@
 package tools
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"gay/plugintools/internal/config"
 	"gay/plugintools/internal/core"
 )
 
 // FileManager 文件管理工具
-type FileManager struct{}
+type FileManager struct {
+	watches    *watchHub
+	uploads    *uploadStore
+	checksums  map[string]checksumCacheEntry
+	checksumMu sync.Mutex
+	registry   core.ToolRegistry
+	limiter    core.ToolLimiter
+}
 
 // NewFileManager 创建新的文件管理工具实例
 func NewFileManager() *FileManager {
-	return &FileManager{}
+	fm := &FileManager{
+		uploads:   newUploadStore(),
+		checksums: make(map[string]checksumCacheEntry),
+	}
+	fm.watches = newWatchHub(fm.dispatchWatchAction)
+	return fm
 }
 
 // GetInfo 实现Tool接口
@@ -24,12 +37,46 @@ func (fm *FileManager) GetInfo() core.ToolInfo {
 	return core.ToolInfo{
 		ID:          "file-manager",
 		Name:        "File Manager",
-		Description: "Provides file system operations like list, copy, move, delete",
+		Description: "Provides file system operations like list, copy, move, delete, archive, extract, watch for changes, checksum, diff and patch",
 		Version:     "1.0.0",
 		Category:    "System",
 	}
 }
 
+// OperationTags 实现core.OperationTagger接口，删除、移动、解压、修改文件内容以及
+// 可能覆盖已有文件的复制、归档和上传标注为destructive
+func (fm *FileManager) OperationTags(operation string, params map[string]interface{}) []string {
+	destructive := false
+	switch operation {
+	case "delete", "move", "extract":
+		destructive = true
+	case "patch":
+		dryRun, _ := params["dry_run"].(bool)
+		destructive = !dryRun
+	case "copy":
+		destructive = overwrites(params)
+	case "archive":
+		dest, _ := params["destination"].(string)
+		_, err := os.Lstat(dest)
+		destructive = !os.IsNotExist(err)
+	case "upload":
+		// 冲突策略在创建上传会话时确定，完成上传时按该策略写入目标
+		if id, _ := params["upload_id"].(string); id == "" {
+			destructive = overwrites(params)
+		}
+	}
+	if destructive {
+		return []string{core.TagDestructive}
+	}
+	return nil
+}
+
+// overwrites 检查参数的冲突策略是否会覆盖已存在的目标
+func overwrites(params map[string]interface{}) bool {
+	opts, err := parseCopyOptions(params)
+	return err != nil || opts.conflict == conflictOverwrite
+}
+
 // GetParams 实现Tool接口
 func (fm *FileManager) GetParams() []core.ParamSpec {
 	return []core.ParamSpec{
@@ -37,7 +84,7 @@ func (fm *FileManager) GetParams() []core.ParamSpec {
 			Name:        "operation",
 			Type:        "string",
 			Required:    true,
-			Description: "Operation to perform (list, copy, move, delete)",
+			Description: "Operation to perform (list, copy, move, delete, archive, extract, watch, unwatch, watches, checksum, diff, patch)",
 		},
 		{
 			Name:        "path",
@@ -49,13 +96,103 @@ func (fm *FileManager) GetParams() []core.ParamSpec {
 			Name:        "destination",
 			Type:        "string",
 			Required:    false,
-			Description: "Destination path for copy/move operations",
+			Description: "Destination path for copy/move/archive/extract operations, or the file to compare against for diff",
+		},
+		{
+			Name:        "conflict",
+			Type:        "string",
+			Required:    false,
+			Default:     "overwrite",
+			Description: "Conflict policy for copy/move when destination exists (overwrite, skip, rename)",
+		},
+		{
+			Name:        "preserve",
+			Type:        "boolean",
+			Required:    false,
+			Default:     false,
+			Description: "Preserve permissions and timestamps when copying, symlinks are always copied as links",
+		},
+		{
+			Name:        "format",
+			Type:        "string",
+			Required:    false,
+			Description: "Archive format for archive/extract (zip, tar, tar.gz, tar.zst), detected from file extension if omitted",
+		},
+		{
+			Name:        "symlinks",
+			Type:        "boolean",
+			Required:    false,
+			Default:     false,
+			Description: "Extract symbolic links from the archive, links are skipped by default",
+		},
+		{
+			Name:        "recursive",
+			Type:        "boolean",
+			Required:    false,
+			Default:     false,
+			Description: "Watch subdirectories recursively",
+		},
+		{
+			Name:        "patterns",
+			Type:        "array",
+			Required:    false,
+			Description: "Glob patterns filtering watched files, matched against file name and path relative to the watch root",
+		},
+		{
+			Name:        "debounce_ms",
+			Type:        "integer",
+			Required:    false,
+			Default:     200,
+			Description: "Debounce interval in milliseconds for watch events",
+		},
+		{
+			Name:        "action",
+			Type:        "object",
+			Required:    false,
+			Description: "Tool call triggered by watch events: {\"tool_id\": ..., \"params\": {...}}, a string value or argv element equal to {{path}} or {{op}} is replaced, placeholders are not allowed in command or script",
+		},
+		{
+			Name:        "watch_id",
+			Type:        "string",
+			Required:    false,
+			Description: "Watch ID for unwatch operation",
+		},
+		{
+			Name:        "algorithm",
+			Type:        "string",
+			Required:    false,
+			Default:     "sha256",
+			Description: "Checksum algorithm (sha256, md5, blake3)",
+		},
+		{
+			Name:        "content",
+			Type:        "string",
+			Required:    false,
+			Description: "Content to compare the file against for diff when destination is not given",
+		},
+		{
+			Name:        "patch",
+			Type:        "string",
+			Required:    false,
+			Description: "Unified diff to apply for patch operation",
+		},
+		{
+			Name:        "dry_run",
+			Type:        "boolean",
+			Required:    false,
+			Default:     false,
+			Description: "Check whether the patch applies without modifying the file",
 		},
 	}
 }
 
 // Execute 实现Tool接口
 func (fm *FileManager) Execute(params map[string]interface{}) (interface{}, error) {
+	return fm.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext 实现core.ContextTool接口，监听动作以创建者的身份调用目标工具
+func (fm *FileManager) ExecuteContext(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	operation, ok := params["operation"].(string)
 	if !ok {
 		return nil, fmt.Errorf("operation parameter is required")
@@ -84,10 +221,40 @@ func (fm *FileManager) Execute(params map[string]interface{}) (interface{}, erro
 		if !fm.isPathAllowed(dest) {
 			return nil, fmt.Errorf("access to destination path %s is not allowed", dest)
 		}
+		opts, err := parseCopyOptions(params)
+		if err != nil {
+			return nil, err
+		}
 		if operation == "copy" {
-			return nil, fm.copy(path, dest)
+			return fm.copy(path, dest, opts)
 		}
-		return nil, fm.move(path, dest)
+		return fm.move(path, dest, opts)
+	case "archive", "extract":
+		dest, ok := params["destination"].(string)
+		if !ok {
+			return nil, fmt.Errorf("destination parameter is required for archive/extract operations")
+		}
+		if !fm.isPathAllowed(dest) {
+			return nil, fmt.Errorf("access to destination path %s is not allowed", dest)
+		}
+		format, _ := params["format"].(string)
+		if operation == "archive" {
+			return fm.archive(path, dest, format)
+		}
+		symlinks, _ := params["symlinks"].(bool)
+		return fm.extract(path, dest, format, symlinks)
+	case "watch":
+		return fm.watch(ctx, path, params)
+	case "unwatch":
+		return fm.unwatch(path, params)
+	case "watches":
+		return fm.listWatches(path)
+	case "checksum":
+		return fm.checksum(path, params)
+	case "diff":
+		return fm.diff(path, params)
+	case "patch":
+		return fm.patch(path, params)
 	default:
 		return nil, fmt.Errorf("unsupported operation: %s", operation)
 	}
@@ -95,6 +262,11 @@ func (fm *FileManager) Execute(params map[string]interface{}) (interface{}, erro
 
 // isPathAllowed 检查路径是否在允许的范围内
 func (fm *FileManager) isPathAllowed(path string) bool {
+	return isAllowedPath(path)
+}
+
+// isAllowedPath 检查路径是否位于file_manager配置的允许路径内，供其他工具复用
+func isAllowedPath(path string) bool {
 	cfg := config.Get()
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -113,6 +285,53 @@ func (fm *FileManager) isPathAllowed(path string) bool {
 	return false
 }
 
+// isAllowedRealPath 检查已解析符号链接的真实路径是否位于允许路径内，允许路径本身也按真实路径比较
+func isAllowedRealPath(path string) bool {
+	if isAllowedPath(path) {
+		return true
+	}
+	for _, allowedPath := range config.Get().Tools.FileManager.AllowedPaths {
+		allowedReal, err := filepath.EvalSymlinks(allowedPath)
+		if err != nil {
+			continue
+		}
+		if isSubPath(allowedReal, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAllowedPath 解析路径中的符号链接并检查真实路径是否位于允许路径内，返回真实路径
+// 路径不存在时解析其父目录，用于即将创建的文件
+func resolveAllowedPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		parent, perr := filepath.EvalSymlinks(filepath.Dir(path))
+		if perr != nil {
+			return "", perr
+		}
+		resolved, err = filepath.Join(parent, filepath.Base(path)), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !isAllowedRealPath(resolved) {
+		return "", fmt.Errorf("access to path %s is not allowed", path)
+	}
+	return resolved, nil
+}
+
+// openAllowed 按真实路径检查后打开文件，打开时不跟随最后一级符号链接，
+// 避免检查之后路径被替换为指向允许路径之外的链接
+func openAllowed(path string, flag int, perm os.FileMode) (*os.File, error) {
+	resolved, err := resolveAllowedPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(resolved, flag|openNoFollow, perm)
+}
+
 // isSubPath 检查childPath是否是parentPath的子路径
 func isSubPath(parentPath, childPath string) bool {
 	rel, err := filepath.Rel(parentPath, childPath)
@@ -152,73 +371,3 @@ func (fm *FileManager) list(path string) ([]map[string]interface{}, error) {
 func (fm *FileManager) delete(path string) error {
 	return os.RemoveAll(path)
 }
-
-// copy 复制文件或目录
-func (fm *FileManager) copy(src, dst string) error {
-	sourceInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-
-	// 检查文件大小限制
-	if !sourceInfo.IsDir() && sourceInfo.Size() > config.Get().Tools.FileManager.MaxFileSize {
-		return fmt.Errorf("file size exceeds maximum allowed size of %d bytes", config.Get().Tools.FileManager.MaxFileSize)
-	}
-
-	if sourceInfo.IsDir() {
-		return fm.copyDir(src, dst)
-	}
-	return fm.copyFile(src, dst)
-}
-
-// copyFile 复制单个文件
-func (fm *FileManager) copyFile(src, dst string) error {
-	source, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer source.Close()
-
-	destination, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destination.Close()
-
-	_, err = io.Copy(destination, source)
-	return err
-}
-
-// copyDir 复制目录
-func (fm *FileManager) copyDir(src, dst string) error {
-	if err := os.MkdirAll(dst, 0755); err != nil {
-		return err
-	}
-
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			if err := fm.copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := fm.copyFile(srcPath, dstPath); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// move 移动文件或目录
-func (fm *FileManager) move(src, dst string) error {
-	return os.Rename(src, dst)
-}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package tools
+
+// openNoFollow 其他平台不支持O_NOFOLLOW，依赖打开前的真实路径检查
+const openNoFollow = 0
@@ -0,0 +1,505 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+const (
+	// uploadExpiry 未完成的上传会话在空闲多久后被清理
+	uploadExpiry = 24 * time.Hour
+	// uploadSweepInterval 定期清理过期会话的间隔
+	uploadSweepInterval = 10 * time.Minute
+	// defaultMaxUploads 同时进行的上传会话数的默认上限
+	defaultMaxUploads = 64
+	// maxChecksumCache 校验和缓存的最大条目数
+	maxChecksumCache = 1024
+)
+
+// uploadSession 一个可续传的分块上传会话
+type uploadSession struct {
+	ID        string    `json:"upload_id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Conflict  string    `json:"conflict"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	owner    string // 创建会话的调用方，未启用认证时为空
+	tempPath string
+	hasher   hash.Hash
+	mu       sync.Mutex
+}
+
+// uploadStore 管理进行中的上传会话
+type uploadStore struct {
+	sessions map[string]*uploadSession
+	mu       sync.Mutex
+	done     chan struct{}
+	once     sync.Once
+}
+
+// newUploadStore 创建上传会话存储并启动定期清理
+func newUploadStore() *uploadStore {
+	s := &uploadStore{
+		sessions: make(map[string]*uploadSession),
+		done:     make(chan struct{}),
+	}
+	go s.sweep()
+	return s
+}
+
+// sweep 定期清理过期会话，避免没有新请求时临时文件一直保留
+func (s *uploadStore) sweep() {
+	ticker := time.NewTicker(uploadSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.expireLocked()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// get 获取调用方自己的上传会话，其他调用方的会话视为不存在
+func (s *uploadStore) get(id string, caller *core.Caller) (*uploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked()
+	session, exists := s.sessions[id]
+	if !exists || (caller != nil && caller.ID != session.owner) {
+		return nil, fmt.Errorf("upload not found: %s", id)
+	}
+	return session, nil
+}
+
+// put 保存上传会话，会话数达到上限时返回错误
+func (s *uploadStore) put(session *uploadSession) error {
+	maxUploads := config.Get().Tools.FileManager.MaxUploads
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked()
+	if len(s.sessions) >= maxUploads {
+		return fmt.Errorf("maximum number of uploads (%d) reached", maxUploads)
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// close 停止定期清理并删除所有未完成上传的临时文件
+func (s *uploadStore) close() {
+	s.once.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		os.Remove(session.tempPath)
+		delete(s.sessions, id)
+	}
+}
+
+// remove 移除上传会话并删除临时文件
+func (s *uploadStore) remove(id string) {
+	s.mu.Lock()
+	session, exists := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if exists {
+		os.Remove(session.tempPath)
+	}
+}
+
+// expireLocked 清理过期会话，调用方需持有锁
+// 写入分块时先持有会话锁再获取存储锁，这里只尝试加锁并跳过正在写入的会话，避免死锁和删除正在写入的临时文件
+func (s *uploadStore) expireLocked() {
+	for id, session := range s.sessions {
+		if !session.mu.TryLock() {
+			continue
+		}
+		if time.Since(session.UpdatedAt) > uploadExpiry {
+			os.Remove(session.tempPath)
+			delete(s.sessions, id)
+		}
+		session.mu.Unlock()
+	}
+}
+
+// checkTransferPath 检查传输路径是否允许访问，返回解析符号链接后的真实路径
+func (fm *FileManager) checkTransferPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+	if !fm.isPathAllowed(path) {
+		return "", fmt.Errorf("access to path %s is not allowed", path)
+	}
+	return resolveAllowedPath(path)
+}
+
+// handleUpload 分块上传端点
+//
+//	POST   ?path=...&size=...[&sha256=...][&conflict=...]  创建上传会话，conflict为目标已存在时的处理策略
+//	PUT    ?upload_id=...  带Content-Range头写入分块
+//	HEAD   ?upload_id=...  查询已上传偏移量，用于断点续传
+//	DELETE ?upload_id=...  取消上传
+func (fm *FileManager) handleUpload(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		fm.createUpload(w, r)
+	case http.MethodPut:
+		fm.uploadChunk(w, r)
+	case http.MethodHead:
+		session, err := fm.uploads.get(r.URL.Query().Get("upload_id"), core.CallerFromContext(r.Context()))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		session.mu.Lock()
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+		session.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("upload_id")
+		if _, err := fm.uploads.get(id, core.CallerFromContext(r.Context())); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fm.uploads.remove(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createUpload 创建上传会话，临时文件与目标文件位于同一目录以便原子重命名
+func (fm *FileManager) createUpload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	// 之后的临时文件和提交都使用真实路径，不会经由符号链接写到允许路径之外
+	path, err := fm.checkTransferPath(query.Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	size, err := strconv.ParseInt(query.Get("size"), 10, 64)
+	if err != nil || size < 0 {
+		http.Error(w, "size parameter must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	maxSize := config.Get().Tools.FileManager.MaxFileSize
+	if size > maxSize {
+		http.Error(w, fmt.Sprintf("file size exceeds maximum allowed size of %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	opts, err := parseCopyOptions(map[string]interface{}{"conflict": query.Get("conflict")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 目标已存在且策略为skip时无需上传
+	if _, err := os.Lstat(path); err == nil && opts.conflict == conflictSkip {
+		writeTransferJSON(w, http.StatusOK, map[string]interface{}{"path": path, "skipped": true})
+		return
+	}
+
+	session := &uploadSession{
+		ID:        fmt.Sprintf("upload_%d", time.Now().UnixNano()),
+		Path:      path,
+		Size:      size,
+		Checksum:  strings.ToLower(query.Get("sha256")),
+		Conflict:  opts.conflict,
+		UpdatedAt: time.Now(),
+		hasher:    sha256.New(),
+	}
+	if caller := core.CallerFromContext(r.Context()); caller != nil {
+		session.owner = caller.ID
+	}
+	session.tempPath = filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+session.ID)
+
+	f, err := os.OpenFile(session.tempPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f.Close()
+
+	if err := fm.uploads.put(session); err != nil {
+		os.Remove(session.tempPath)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if size == 0 {
+		fm.finishUpload(w, session)
+		return
+	}
+
+	writeTransferJSON(w, http.StatusCreated, session)
+}
+
+// parseContentRange 解析 "bytes start-end/total" 格式的Content-Range头
+func parseContentRange(header string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+	}
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+	}
+	startStr, endStr, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+	}
+
+	if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range start: %v", err)
+	}
+	if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range end: %v", err)
+	}
+	if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range total: %v", err)
+	}
+	if start < 0 || end < start {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+	}
+	return start, end, total, nil
+}
+
+// uploadChunk 写入一个分块，分块必须从当前偏移量开始
+func (fm *FileManager) uploadChunk(w http.ResponseWriter, r *http.Request) {
+	session, err := fm.uploads.get(r.URL.Query().Get("upload_id"), core.CallerFromContext(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	start, end, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if total != session.Size || end >= session.Size {
+		http.Error(w, "Content-Range does not match upload size", http.StatusBadRequest)
+		return
+	}
+	if start != session.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		http.Error(w, fmt.Sprintf("chunk must start at offset %d", session.Offset), http.StatusConflict)
+		return
+	}
+
+	f, err := os.OpenFile(session.tempPath, os.O_WRONLY|openNoFollow, 0644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// 分块直接流式写入临时文件，校验失败时回滚整体哈希状态且不推进偏移量
+	snapshot, err := session.hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chunkHasher := sha256.New()
+	length := end - start + 1
+	writer := io.MultiWriter(io.NewOffsetWriter(f, start), chunkHasher, session.hasher)
+	n, err := io.Copy(writer, io.LimitReader(r.Body, length))
+	extra, _ := r.Body.Read(make([]byte, 1))
+
+	expected := r.Header.Get("X-Chunk-Checksum-SHA256")
+	switch {
+	case err != nil:
+	case n != length || extra > 0:
+		err = fmt.Errorf("chunk body length does not match Content-Range")
+	case expected != "" && !strings.EqualFold(hex.EncodeToString(chunkHasher.Sum(nil)), expected):
+		err = fmt.Errorf("chunk checksum mismatch")
+	}
+	if err != nil {
+		session.hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(snapshot)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session.Offset = end + 1
+	session.UpdatedAt = time.Now()
+
+	if session.Offset < session.Size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		writeTransferJSON(w, http.StatusOK, session)
+		return
+	}
+	fm.finishUpload(w, session)
+}
+
+// finishUpload 校验整体校验和后将临时文件原子地移动到目标位置
+func (fm *FileManager) finishUpload(w http.ResponseWriter, session *uploadSession) {
+	defer fm.uploads.remove(session.ID)
+
+	sum := hex.EncodeToString(session.hasher.Sum(nil))
+	if session.Checksum != "" && session.Checksum != sum {
+		http.Error(w, fmt.Sprintf("checksum mismatch: expected %s, got %s", session.Checksum, sum), http.StatusUnprocessableEntity)
+		return
+	}
+
+	path, skipped, err := commitUpload(session.tempPath, session.Path, session.Conflict)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeTransferJSON(w, http.StatusOK, map[string]interface{}{
+		"path":     path,
+		"size":     session.Size,
+		"sha256":   sum,
+		"complete": true,
+		"skipped":  skipped,
+	})
+}
+
+// commitUpload 按冲突策略将临时文件移动到目标位置，返回实际路径；skipped为true表示目标已存在而未写入
+// skip和rename通过硬链接创建目标，目标在上传期间被创建时也不会被覆盖
+func commitUpload(tempPath, dst, conflict string) (string, bool, error) {
+	if conflict == conflictOverwrite {
+		return dst, false, os.Rename(tempPath, dst)
+	}
+
+	for i := 0; i < 10; i++ {
+		target, skip, err := resolveConflict(dst, conflict)
+		if err != nil {
+			return "", false, err
+		}
+		if skip {
+			return dst, true, nil
+		}
+		err = os.Link(tempPath, target)
+		if err == nil {
+			return target, false, os.Remove(tempPath)
+		}
+		if !os.IsExist(err) {
+			return "", false, err
+		}
+	}
+	return "", false, fmt.Errorf("cannot find an available name for %s", dst)
+}
+
+// checksumCacheEntry 缓存的文件校验和
+type checksumCacheEntry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// handleDownload 下载端点，支持Range请求并通过X-Checksum-SHA256头返回整个文件的校验和
+func (fm *FileManager) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := filepath.Base(r.URL.Query().Get("path"))
+	path, err := fm.checkTransferPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY|openNoFollow, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "cannot download a directory", http.StatusBadRequest)
+		return
+	}
+	maxSize := config.Get().Tools.FileManager.MaxFileSize
+	if info.Size() > maxSize {
+		http.Error(w, fmt.Sprintf("file size exceeds maximum allowed size of %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	sum, err := fm.fileChecksum(path, f, info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Checksum-SHA256", sum)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// fileChecksum 计算文件的SHA-256，按大小和修改时间缓存结果
+func (fm *FileManager) fileChecksum(path string, f *os.File, info os.FileInfo) (string, error) {
+	fm.checksumMu.Lock()
+	cached, ok := fm.checksums[path]
+	fm.checksumMu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	fm.checksumMu.Lock()
+	if len(fm.checksums) >= maxChecksumCache {
+		fm.checksums = make(map[string]checksumCacheEntry)
+	}
+	fm.checksums[path] = checksumCacheEntry{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	fm.checksumMu.Unlock()
+	return sum, nil
+}
+
+// writeTransferJSON 写入带状态码的JSON响应
+func writeTransferJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,719 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
+
+	"gay/plugintools/internal/auth"
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+)
+
+// 监听相关的默认值
+const (
+	defaultMaxWatches    = 64
+	defaultWatchDebounce = 200 * time.Millisecond
+	maxWatchDebounce     = time.Minute
+	maxWatchDispatches   = 4 // 每个监听同时执行的工具调用上限
+)
+
+// 动作参数中的占位符，只能作为整个参数值或argv元素出现
+const (
+	watchPathPlaceholder = "{{path}}"
+	watchOpPlaceholder   = "{{op}}"
+)
+
+// watchCommandParams 值会被切分或解释为命令的参数，文件名不能出现在其中
+var watchCommandParams = []string{"command", "script"}
+
+// WatchEvent 文件系统变更事件
+type WatchEvent struct {
+	WatchID string    `json:"watch_id"`
+	Path    string    `json:"path"`
+	Op      string    `json:"op"`
+	Time    time.Time `json:"time"`
+}
+
+// watchAction 事件触发时调用的工具，以创建监听的调用方身份执行
+type watchAction struct {
+	ToolID string                 `json:"tool_id"`
+	Params map[string]interface{} `json:"params"`
+	caller *core.Caller
+}
+
+// watchOptions 创建监听订阅的选项
+type watchOptions struct {
+	Root      string        `json:"root"`
+	Recursive bool          `json:"recursive"`
+	Patterns  []string      `json:"patterns,omitempty"`
+	Debounce  time.Duration `json:"-"`
+	Action    *watchAction  `json:"action,omitempty"`
+}
+
+// watchSubscription 一个监听订阅
+type watchSubscription struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	watchOptions
+
+	watcher *fsnotify.Watcher
+	events  chan []WatchEvent
+	slots   chan struct{} // 限制同时执行的动作数
+	done    chan struct{}
+	once    sync.Once
+}
+
+// watchHub 管理所有监听订阅
+type watchHub struct {
+	subs     map[string]*watchSubscription
+	mu       sync.Mutex
+	dispatch func(action *watchAction, event WatchEvent)
+}
+
+// newWatchHub 创建监听管理器
+func newWatchHub(dispatch func(action *watchAction, event WatchEvent)) *watchHub {
+	return &watchHub{
+		subs:     make(map[string]*watchSubscription),
+		dispatch: dispatch,
+	}
+}
+
+// subscribe 创建并启动一个监听订阅
+func (h *watchHub) subscribe(opts watchOptions) (*watchSubscription, error) {
+	maxWatches := config.Get().Tools.FileManager.MaxWatches
+	if maxWatches <= 0 {
+		maxWatches = defaultMaxWatches
+	}
+
+	for _, pattern := range opts.Patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &watchSubscription{
+		ID:           fmt.Sprintf("watch_%d", time.Now().UnixNano()),
+		CreatedAt:    time.Now(),
+		watchOptions: opts,
+		watcher:      watcher,
+		events:       make(chan []WatchEvent, 16),
+		slots:        make(chan struct{}, maxWatchDispatches),
+		done:         make(chan struct{}),
+	}
+
+	if err := sub.add(opts.Root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if len(h.subs) >= maxWatches {
+		h.mu.Unlock()
+		watcher.Close()
+		return nil, fmt.Errorf("maximum number of watches (%d) reached", maxWatches)
+	}
+	h.subs[sub.ID] = sub
+	h.mu.Unlock()
+
+	go h.run(sub)
+	return sub, nil
+}
+
+// unsubscribe 停止并移除监听订阅
+func (h *watchHub) unsubscribe(id string) error {
+	h.mu.Lock()
+	sub, exists := h.subs[id]
+	delete(h.subs, id)
+	h.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("watch not found: %s", id)
+	}
+	sub.close()
+	return nil
+}
+
+// get 获取指定ID的监听订阅
+func (h *watchHub) get(id string) (*watchSubscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub, exists := h.subs[id]
+	if !exists {
+		return nil, fmt.Errorf("watch not found: %s", id)
+	}
+	return sub, nil
+}
+
+// list 列出根路径位于root之下的监听订阅
+func (h *watchHub) list(root string) []*watchSubscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs := make([]*watchSubscription, 0, len(h.subs))
+	for _, sub := range h.subs {
+		if isSubPath(root, sub.Root) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// closeAll 停止所有监听订阅
+func (h *watchHub) closeAll() {
+	h.mu.Lock()
+	subs := h.subs
+	h.subs = make(map[string]*watchSubscription)
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+// add 添加监听路径，递归模式下包含所有子目录
+func (sub *watchSubscription) add(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !sub.Recursive || !info.IsDir() {
+		return sub.watcher.Add(path)
+	}
+
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return sub.watcher.Add(p)
+		}
+		return nil
+	})
+}
+
+// matches 检查路径是否匹配过滤模式，模式同时匹配文件名和相对路径
+func (sub *watchSubscription) matches(path string) bool {
+	if len(sub.Patterns) == 0 {
+		return true
+	}
+
+	rel, err := filepath.Rel(sub.Root, path)
+	if err != nil {
+		rel = path
+	}
+	for _, pattern := range sub.Patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// close 停止底层watcher，可重复调用
+func (sub *watchSubscription) close() {
+	sub.once.Do(func() {
+		close(sub.done)
+		sub.watcher.Close()
+	})
+}
+
+// run 读取文件系统事件，按防抖间隔合并后分发
+func (h *watchHub) run(sub *watchSubscription) {
+	defer close(sub.events)
+
+	pending := make(map[string]WatchEvent)
+	timer := time.NewTimer(sub.Debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-sub.done:
+			return
+		case event, ok := <-sub.watcher.Events:
+			if !ok {
+				return
+			}
+			// 递归模式下新建的目录需要加入监听
+			if sub.Recursive && event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := sub.add(event.Name); err != nil {
+						log.Printf("watch %s: failed to add %s: %v", sub.ID, event.Name, err)
+					}
+				}
+			}
+			if !sub.matches(event.Name) {
+				continue
+			}
+			pending[event.Name] = WatchEvent{
+				WatchID: sub.ID,
+				Path:    event.Name,
+				Op:      strings.ToLower(event.Op.String()),
+				Time:    time.Now(),
+			}
+			timer.Reset(sub.Debounce)
+		case err, ok := <-sub.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watch %s: %v", sub.ID, err)
+		case <-timer.C:
+			batch := make([]WatchEvent, 0, len(pending))
+			for _, event := range pending {
+				batch = append(batch, event)
+			}
+			pending = make(map[string]WatchEvent)
+			h.deliver(sub, batch)
+		}
+	}
+}
+
+// deliver 将一批事件交给订阅者或触发工具调用
+// 触发工具调用时每个监听最多同时执行maxWatchDispatches个调用，超出的事件被丢弃
+func (h *watchHub) deliver(sub *watchSubscription, batch []WatchEvent) {
+	if sub.Action != nil {
+		dropped := 0
+		for _, event := range batch {
+			select {
+			case sub.slots <- struct{}{}:
+				go func(event WatchEvent) {
+					defer func() { <-sub.slots }()
+					h.dispatch(sub.Action, event)
+				}(event)
+			default:
+				dropped++
+			}
+		}
+		if dropped > 0 {
+			log.Printf("watch %s: too many running actions, dropped %d events", sub.ID, dropped)
+		}
+		return
+	}
+
+	select {
+	case sub.events <- batch:
+	case <-sub.done:
+	default:
+		log.Printf("watch %s: subscriber is not keeping up, dropped %d events", sub.ID, len(batch))
+	}
+}
+
+// parseWatchOptions 从工具参数或查询字符串解析监听选项
+func parseWatchOptions(path string, recursive bool, patterns []string, debounceMs int) (watchOptions, error) {
+	debounce := defaultWatchDebounce
+	if debounceMs > 0 {
+		debounce = time.Duration(debounceMs) * time.Millisecond
+	}
+	if debounce > maxWatchDebounce {
+		return watchOptions{}, fmt.Errorf("debounce exceeds maximum of %v", maxWatchDebounce)
+	}
+
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return watchOptions{}, err
+	}
+
+	return watchOptions{
+		Root:      root,
+		Recursive: recursive,
+		Patterns:  patterns,
+		Debounce:  debounce,
+	}, nil
+}
+
+// watch 创建一个触发工具调用的监听订阅，调用方必须有权执行目标工具的操作
+func (fm *FileManager) watch(ctx context.Context, path string, params map[string]interface{}) (interface{}, error) {
+	rawAction, ok := params["action"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("action parameter is required for watch operation, use the watch endpoint for streaming")
+	}
+	action := &watchAction{}
+	action.ToolID, _ = rawAction["tool_id"].(string)
+	action.Params, _ = rawAction["params"].(map[string]interface{})
+	if action.ToolID == "" {
+		return nil, fmt.Errorf("action.tool_id is required")
+	}
+	if err := checkWatchPlaceholders(action.Params); err != nil {
+		return nil, err
+	}
+	if action.ToolID == fm.GetInfo().ID {
+		return nil, fmt.Errorf("watch action cannot target %s itself", action.ToolID)
+	}
+	action.caller = core.CallerFromContext(ctx)
+	if fm.registry != nil {
+		tool, err := fm.registry.Get(action.ToolID)
+		if err != nil {
+			return nil, err
+		}
+		operation := auth.Operation(tool, action.Params)
+		if !auth.Authorize(action.caller, action.ToolID, operation) {
+			return nil, fmt.Errorf("operation %s of %s is not permitted", operation, action.ToolID)
+		}
+		if auth.RequiresApproval(tool, operation, action.Params) {
+			return nil, fmt.Errorf("operation %s of %s requires approval and cannot be triggered by a watch", operation, action.ToolID)
+		}
+	}
+
+	recursive, _ := params["recursive"].(bool)
+	var patterns []string
+	if raw, ok := params["patterns"].([]interface{}); ok {
+		for _, p := range raw {
+			if s, ok := p.(string); ok {
+				patterns = append(patterns, s)
+			}
+		}
+	}
+	debounce, _ := params["debounce_ms"].(float64)
+
+	opts, err := parseWatchOptions(path, recursive, patterns, int(debounce))
+	if err != nil {
+		return nil, err
+	}
+	opts.Action = action
+
+	return fm.watches.subscribe(opts)
+}
+
+// unwatch 取消监听订阅，订阅的根路径必须位于path之下
+func (fm *FileManager) unwatch(path string, params map[string]interface{}) (interface{}, error) {
+	id, ok := params["watch_id"].(string)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("watch_id is required for unwatch operation")
+	}
+
+	sub, err := fm.watches.get(id)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isSubPath(root, sub.Root) {
+		return nil, fmt.Errorf("watch %s is not under %s", id, path)
+	}
+
+	if err := fm.watches.unsubscribe(id); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Watch %s removed", id),
+	}, nil
+}
+
+// listWatches 列出path之下的监听订阅
+func (fm *FileManager) listWatches(path string) (interface{}, error) {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return fm.watches.list(root), nil
+}
+
+// checkWatchPlaceholders 检查动作参数中的占位符，占位符必须是整个字符串值，
+// 且不能出现在会被切分成命令的参数中，避免文件名被解析为额外的参数
+func checkWatchPlaceholders(params map[string]interface{}) error {
+	for key, value := range params {
+		if contains(watchCommandParams, key) && hasWatchPlaceholder(value) {
+			return fmt.Errorf("action parameter %s cannot contain placeholders, use argv instead", key)
+		}
+		if err := checkWatchPlaceholder(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkWatchPlaceholder(key string, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		if v != watchPathPlaceholder && v != watchOpPlaceholder &&
+			(strings.Contains(v, watchPathPlaceholder) || strings.Contains(v, watchOpPlaceholder)) {
+			return fmt.Errorf("action parameter %s: placeholders must be the whole value", key)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			if err := checkWatchPlaceholder(key+"."+k, item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := checkWatchPlaceholder(key, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasWatchPlaceholder 检查参数值（包括嵌套的map和列表）中是否包含占位符
+func hasWatchPlaceholder(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, watchPathPlaceholder) || strings.Contains(v, watchOpPlaceholder)
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasWatchPlaceholder(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasWatchPlaceholder(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// substituteWatchParam 返回将等于占位符的字符串值替换为事件信息后的参数副本
+func substituteWatchParam(value interface{}, event WatchEvent) interface{} {
+	switch v := value.(type) {
+	case string:
+		switch v {
+		case watchPathPlaceholder:
+			return event.Path
+		case watchOpPlaceholder:
+			return event.Op
+		}
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[k] = substituteWatchParam(item, event)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = substituteWatchParam(item, event)
+		}
+		return result
+	}
+	return value
+}
+
+// dispatchWatchAction 以事件信息替换参数中的占位符后调用目标工具
+func (fm *FileManager) dispatchWatchAction(action *watchAction, event WatchEvent) {
+	if fm.registry == nil {
+		log.Printf("watch %s: no registry configured, cannot call %s", event.WatchID, action.ToolID)
+		return
+	}
+	tool, err := fm.registry.Get(action.ToolID)
+	if err != nil {
+		log.Printf("watch %s: %v", event.WatchID, err)
+		return
+	}
+
+	// 先解析创建监听时的参数中的密钥引用再替换占位符，文件名中的引用不会被解析
+	resolved, err := auth.ResolveSecrets(action.caller, action.Params)
+	if err != nil {
+		log.Printf("watch %s: %v", event.WatchID, err)
+		return
+	}
+	params, _ := substituteWatchParam(action.Params, event).(map[string]interface{})
+	execParams, _ := substituteWatchParam(resolved, event).(map[string]interface{})
+
+	// 占位符可能改变操作名，执行前按替换后的参数再次授权
+	operation := auth.Operation(tool, params)
+	if !auth.Authorize(action.caller, action.ToolID, operation) || auth.RequiresApproval(tool, operation, params) {
+		log.Printf("watch %s: operation %s of %s is not permitted", event.WatchID, operation, action.ToolID)
+		return
+	}
+	// 策略条件通常依赖参数值，只在占位符替换后检查
+	decision := policy.Check(policy.Input{Caller: action.caller, ToolID: action.ToolID, Operation: operation, Params: params})
+	if !decision.Allowed {
+		log.Printf("watch %s: %s of %s denied by policy %s", event.WatchID, operation, action.ToolID, decision.Policy)
+		return
+	}
+
+	if fm.limiter != nil {
+		release, err := fm.limiter.AcquireTool(action.ToolID, action.caller)
+		if err != nil {
+			log.Printf("watch %s: %v", event.WatchID, err)
+			return
+		}
+		defer release()
+	}
+
+	if ct, ok := tool.(core.ContextTool); ok {
+		ctx := core.WithUnresolvedParams(core.WithCaller(context.Background(), action.caller), params)
+		_, err = ct.ExecuteContext(ctx, execParams)
+	} else {
+		_, err = tool.Execute(execParams)
+	}
+	if err != nil {
+		log.Printf("watch %s: %s failed: %v", event.WatchID, action.ToolID, err)
+	}
+}
+
+// SetRegistry 设置工具注册表，监听动作通过它调用其他工具
+func (fm *FileManager) SetRegistry(registry core.ToolRegistry) {
+	fm.registry = registry
+}
+
+// SetLimiter 设置工具限流器，监听动作按目标工具的限流和并发上限执行
+func (fm *FileManager) SetLimiter(limiter core.ToolLimiter) {
+	fm.limiter = limiter
+}
+
+// Close 停止所有监听订阅并清理未完成上传的临时文件
+func (fm *FileManager) Close() {
+	fm.watches.closeAll()
+	fm.uploads.close()
+}
+
+// Routes 实现core.RouteProvider接口
+func (fm *FileManager) Routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"watch":    fm.handleWatchSSE,
+		"watch/ws": fm.handleWatchWebSocket,
+		"upload":   fm.handleUpload,
+		"download": fm.handleDownload,
+	}
+}
+
+// subscribeFromRequest 根据查询参数创建订阅
+// 参数: path, recursive, pattern (可重复), debounce_ms
+func (fm *FileManager) subscribeFromRequest(r *http.Request) (*watchSubscription, error) {
+	query := r.URL.Query()
+	path := query.Get("path")
+	if path == "" {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	if !fm.isPathAllowed(path) {
+		return nil, fmt.Errorf("access to path %s is not allowed", path)
+	}
+
+	recursive, _ := strconv.ParseBool(query.Get("recursive"))
+	debounce, _ := strconv.Atoi(query.Get("debounce_ms"))
+	opts, err := parseWatchOptions(path, recursive, query["pattern"], debounce)
+	if err != nil {
+		return nil, err
+	}
+	return fm.watches.subscribe(opts)
+}
+
+// handleWatchSSE 通过Server-Sent Events推送文件变更，客户端断开时自动取消订阅
+func (fm *FileManager) handleWatchSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := fm.subscribeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer fm.watches.unsubscribe(sub.ID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprintf(w, "event: subscribed\ndata: {\"watch_id\":%q}\n\n", sub.ID)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case batch, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			for _, event := range batch {
+				data, _ := json.Marshal(event)
+				fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+var watchUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// handleWatchWebSocket 通过WebSocket推送文件变更，连接关闭时自动取消订阅
+func (fm *FileManager) handleWatchWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, err := fm.subscribeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer fm.watches.unsubscribe(sub.ID)
+
+	conn, err := watchUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// 读取循环用于检测客户端断开
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(map[string]string{"event": "subscribed", "watch_id": sub.ID}); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-closed:
+			return
+		case batch, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			for _, event := range batch {
+				if err := conn.WriteJSON(event); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -44,6 +44,14 @@ func (s *Scheduler) GetInfo() core.ToolInfo {
 	}
 }
 
+// OperationTags 实现core.OperationTagger接口，删除任务标注为destructive
+func (s *Scheduler) OperationTags(operation string, params map[string]interface{}) []string {
+	if operation == "delete" {
+		return []string{core.TagDestructive}
+	}
+	return nil
+}
+
 // GetParams 实现Tool接口
 func (s *Scheduler) GetParams() []core.ParamSpec {
 	return []core.ParamSpec{
@@ -0,0 +1,275 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gay/plugintools/internal/config"
+)
+
+// splitShellWords 按POSIX shell规则将命令行切分为参数，支持单引号、双引号和反斜杠转义
+// 不执行变量展开、通配符展开或命令替换，未加引号的shell操作符会被拒绝
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(line) {
+				i++
+				// 反斜杠加换行表示续行
+				if line[i] != '\n' {
+					word.WriteByte(line[i])
+				}
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(line); i++ {
+				if line[i] == '"' {
+					closed = true
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\\\"$`\n", line[i+1]) >= 0 {
+					i++
+					if line[i] != '\n' {
+						word.WriteByte(line[i])
+					}
+					continue
+				}
+				if line[i] == '$' || line[i] == '`' {
+					return nil, fmt.Errorf("shell expansion is not supported: %q", line[i:])
+				}
+				word.WriteByte(line[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+		case strings.IndexByte("|&;<>()$`", c) >= 0:
+			return nil, fmt.Errorf("shell operator %q is not supported", c)
+		case c == '#' && !inWord:
+			// 注释直到行尾
+			i = len(line)
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseArgv 从argv参数或command参数得到命令参数列表
+func parseArgv(params map[string]interface{}) ([]string, error) {
+	if raw, ok := params["argv"].([]interface{}); ok && len(raw) > 0 {
+		argv := make([]string, 0, len(raw))
+		for _, item := range raw {
+			arg, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argv must be an array of strings")
+			}
+			argv = append(argv, arg)
+		}
+		return argv, nil
+	}
+
+	command, ok := params["command"].(string)
+	if !ok || strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command or argv parameter is required")
+	}
+	argv, err := splitShellWords(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %v", err)
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("command parameter is required")
+	}
+	return argv, nil
+}
+
+// contains 检查字符串切片是否包含指定值
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArguments 按命令配置的参数策略校验参数，没有配置策略的命令不做限制
+func checkArguments(argv []string, workingDir string) error {
+	policy, ok := config.Get().Tools.ShellExecutor.ArgumentPolicies[argv[0]]
+	if !ok {
+		return nil
+	}
+
+	args := argv[1:]
+	if policy.MaxArgs > 0 && len(args) > policy.MaxArgs {
+		return fmt.Errorf("%s accepts at most %d arguments", argv[0], policy.MaxArgs)
+	}
+
+	// 表达式按整体匹配，与模板参数的pattern一致
+	patterns := make([]*regexp.Regexp, 0, len(policy.ArgPatterns))
+	for _, p := range policy.ArgPatterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid argument pattern %q for %s: %v", p, argv[0], err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	if policy.PathArgs && workingDir != "" && !isAllowedPath(workingDir) {
+		return fmt.Errorf("access to working directory %s is not allowed", workingDir)
+	}
+
+	endOfFlags := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !endOfFlags && arg == "--" {
+			endOfFlags = true
+			continue
+		}
+		if !endOfFlags && strings.HasPrefix(arg, "-") && arg != "-" {
+			consumesValue, value, attached, err := checkFlag(arg, policy)
+			if err != nil {
+				return fmt.Errorf("%s: %v", argv[0], err)
+			}
+			if attached {
+				if err := checkFlagValue(arg, value, workingDir, policy, patterns); err != nil {
+					return fmt.Errorf("%s: %v", argv[0], err)
+				}
+			}
+			if consumesValue {
+				if i+1 >= len(args) {
+					return fmt.Errorf("%s: flag %s requires a value", argv[0], arg)
+				}
+				i++
+				if err := checkFlagValue(arg, args[i], workingDir, policy, patterns); err != nil {
+					return fmt.Errorf("%s: %v", argv[0], err)
+				}
+			}
+			continue
+		}
+
+		if err := checkOperand(arg, workingDir, policy, patterns); err != nil {
+			return fmt.Errorf("%s: %v", argv[0], err)
+		}
+	}
+	return nil
+}
+
+// checkFlag 校验一个选项，consumesValue表示其后的参数是该选项的值，
+// attached表示value是写在选项中的值（如 --name=value 或 -d1），调用方需要像单独的值一样校验
+// 支持 --name=value 形式和合并的短选项（如 -lh）
+// 未配置allowed_flags时同样拆分合并的短选项，使 -o/etc/x 中的值与 -o /etc/x 一样被校验
+func checkFlag(arg string, policy config.ArgumentPolicy) (consumesValue bool, value string, attached bool, err error) {
+	name, value, hasValue := strings.Cut(arg, "=")
+	allowed := func(flag string) bool {
+		return len(policy.AllowedFlags) == 0 || contains(policy.AllowedFlags, flag)
+	}
+	combined := !strings.HasPrefix(arg, "--") && len(arg) > 2 && !hasValue
+
+	// 配置中列出的选项（包括 -name 这类单横线长选项）按整体匹配
+	exact := contains(policy.AllowedFlags, name) ||
+		(len(policy.AllowedFlags) == 0 && (!combined || contains(policy.ValueFlags, name)))
+	if exact {
+		return !hasValue && contains(policy.ValueFlags, name), value, hasValue, nil
+	}
+
+	// 合并的短选项逐个检查，带值的短选项只能出现在最后
+	if combined {
+		for j := 1; j < len(arg); j++ {
+			flag := "-" + string(arg[j])
+			if !allowed(flag) {
+				return false, "", false, fmt.Errorf("flag %s is not allowed", flag)
+			}
+			if contains(policy.ValueFlags, flag) {
+				// 余下部分是该选项的值，如 -d1
+				if j == len(arg)-1 {
+					return true, "", false, nil
+				}
+				return false, arg[j+1:], true, nil
+			}
+		}
+		return false, "", false, nil
+	}
+	return false, "", false, fmt.Errorf("flag %s is not allowed", name)
+}
+
+// checkFlagValue 校验选项的值，值必须匹配参数正则；启用path_args时，看起来像路径的值必须位于允许的路径内
+func checkFlagValue(flag, value, workingDir string, policy config.ArgumentPolicy, patterns []*regexp.Regexp) error {
+	if !matchesAny(patterns, value) {
+		return fmt.Errorf("value %q of flag %s does not match allowed patterns", value, flag)
+	}
+	if policy.PathArgs && looksLikePath(value) {
+		path := value
+		if !filepath.IsAbs(path) && workingDir != "" {
+			path = filepath.Join(workingDir, path)
+		}
+		if !isAllowedPath(path) {
+			return fmt.Errorf("access to path %s in flag %s is not allowed", value, flag)
+		}
+	}
+	return nil
+}
+
+// looksLikePath 检查选项值是否可能是路径，如 /etc、../x、~/x，数字等普通值不视为路径
+func looksLikePath(value string) bool {
+	return strings.ContainsRune(value, filepath.Separator) || strings.HasPrefix(value, ".") || strings.HasPrefix(value, "~")
+}
+
+// matchesAny 检查参数是否匹配任一正则表达式，没有配置表达式时总是匹配
+func matchesAny(patterns []*regexp.Regexp, arg string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, re := range patterns {
+		if re.MatchString(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOperand 校验非选项参数
+func checkOperand(arg, workingDir string, policy config.ArgumentPolicy, patterns []*regexp.Regexp) error {
+	if !matchesAny(patterns, arg) {
+		return fmt.Errorf("argument %q does not match allowed patterns", arg)
+	}
+
+	if policy.PathArgs {
+		path := arg
+		if !filepath.IsAbs(path) && workingDir != "" {
+			path = filepath.Join(workingDir, path)
+		}
+		if !isAllowedPath(path) {
+			return fmt.Errorf("access to path %s is not allowed", arg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gay/plugintools/internal/config"
+)
+
+// loadArgumentPolicies 加载只包含参数策略和允许路径的测试配置
+func loadArgumentPolicies(t *testing.T) string {
+	t.Helper()
+	allowed := t.TempDir()
+	data := `{
+		"tools": {
+			"file_manager": {"allowed_paths": ["` + allowed + `"]},
+			"shell_executor": {
+				"argument_policies": {
+					"du": {
+						"allowed_flags": ["-s", "-h", "-d", "--max-depth", "--exclude"],
+						"value_flags": ["-d", "--max-depth"],
+						"path_args": true
+					},
+					"cat": {
+						"value_flags": ["-o"],
+						"path_args": true
+					},
+					"echo": {
+						"arg_patterns": ["[a-z]+"]
+					},
+					"ps": {
+						"allowed_flags": ["-e", "-u", "-p", "--user"],
+						"value_flags": ["-u", "-p", "--user"],
+						"arg_patterns": ["^[A-Za-z0-9_,.-]+$"]
+					}
+				}
+			}
+		}
+	}`
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	return allowed
+}
+
+func TestCheckArgumentsFlagValues(t *testing.T) {
+	allowed := loadArgumentPolicies(t)
+
+	tests := []struct {
+		name    string
+		argv    []string
+		wantErr string
+	}{
+		{name: "separate value", argv: []string{"ps", "-u", "root"}},
+		{name: "separate value rejected", argv: []string{"ps", "-u", "$(id)"}, wantErr: "does not match allowed patterns"},
+		{name: "long attached value", argv: []string{"ps", "--user=root"}},
+		{name: "long attached value rejected", argv: []string{"ps", "--user=$(id)"}, wantErr: "does not match allowed patterns"},
+		{name: "short attached value", argv: []string{"ps", "-uroot"}},
+		{name: "short attached value rejected", argv: []string{"ps", "-u$(id)"}, wantErr: "does not match allowed patterns"},
+		{name: "combined flags with attached value", argv: []string{"ps", "-eu$(id)"}, wantErr: "does not match allowed patterns"},
+		{name: "separate value missing", argv: []string{"ps", "-u"}, wantErr: "requires a value"},
+		{name: "disallowed flag with value", argv: []string{"ps", "--sort=pid"}, wantErr: "not allowed"},
+
+		{name: "numeric separate value", argv: []string{"du", "-d", "1", allowed}},
+		{name: "numeric short attached value", argv: []string{"du", "-d1", allowed}},
+		{name: "numeric long attached value", argv: []string{"du", "--max-depth=1", allowed}},
+		{name: "path attached value inside allowed path", argv: []string{"du", "--exclude=" + filepath.Join(allowed, "cache"), allowed}},
+		{name: "path attached value outside allowed path", argv: []string{"du", "--exclude=/etc", allowed}, wantErr: "not allowed"},
+		{name: "relative path attached value escaping", argv: []string{"du", "--exclude=../../etc", allowed}, wantErr: "not allowed"},
+		{name: "short attached path value", argv: []string{"du", "-d/etc", allowed}, wantErr: "not allowed"},
+		{name: "separate path value", argv: []string{"du", "-d", "/etc", allowed}, wantErr: "not allowed"},
+		{name: "operand outside allowed path", argv: []string{"du", "-s", "/etc"}, wantErr: "not allowed"},
+
+		{name: "unanchored pattern matches whole operand", argv: []string{"echo", "abc"}},
+		{name: "unanchored pattern partial match rejected", argv: []string{"echo", "/etc/shadow;x"}, wantErr: "does not match allowed patterns"},
+		{name: "pattern must cover entire argument", argv: []string{"echo", "abc def"}, wantErr: "does not match allowed patterns"},
+
+		{name: "no allowlist separate path value", argv: []string{"cat", "-o", "/etc/shadow"}, wantErr: "not allowed"},
+		{name: "no allowlist attached path value", argv: []string{"cat", "-o/etc/shadow"}, wantErr: "not allowed"},
+		{name: "no allowlist combined attached path value", argv: []string{"cat", "-vo/etc/shadow"}, wantErr: "not allowed"},
+		{name: "no allowlist attached value inside allowed path", argv: []string{"cat", "-o" + filepath.Join(allowed, "out")}},
+		{name: "no allowlist plain flag", argv: []string{"cat", "-n", filepath.Join(allowed, "in")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkArguments(tt.argv, allowed)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckFlag(t *testing.T) {
+	policy := config.ArgumentPolicy{
+		AllowedFlags: []string{"-l", "-d", "--depth", "--color"},
+		ValueFlags:   []string{"-d", "--depth"},
+	}
+
+	tests := []struct {
+		arg           string
+		consumesValue bool
+		value         string
+		attached      bool
+		wantErr       bool
+	}{
+		{arg: "-l"},
+		{arg: "-d", consumesValue: true},
+		{arg: "--depth", consumesValue: true},
+		{arg: "--depth=2", value: "2", attached: true},
+		{arg: "--color=always", value: "always", attached: true},
+		{arg: "--depth=", value: "", attached: true},
+		{arg: "-ld", consumesValue: true},
+		{arg: "-ld3", value: "3", attached: true},
+		{arg: "-d3", value: "3", attached: true},
+		{arg: "-x", wantErr: true},
+		{arg: "-lx", wantErr: true},
+		{arg: "--other=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			consumesValue, value, attached, err := checkFlag(tt.arg, policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if consumesValue != tt.consumesValue || value != tt.value || attached != tt.attached {
+				t.Fatalf("got (%v, %q, %v), want (%v, %q, %v)", consumesValue, value, attached, tt.consumesValue, tt.value, tt.attached)
+			}
+		})
+	}
+}
+
+func TestCheckFlagWithoutAllowlist(t *testing.T) {
+	policy := config.ArgumentPolicy{
+		ValueFlags: []string{"-o", "-name", "--output"},
+	}
+
+	tests := []struct {
+		arg           string
+		consumesValue bool
+		value         string
+		attached      bool
+	}{
+		{arg: "-n"},
+		{arg: "-o", consumesValue: true},
+		{arg: "-o/etc/shadow", value: "/etc/shadow", attached: true},
+		{arg: "-vo/etc/shadow", value: "/etc/shadow", attached: true},
+		{arg: "-vn"},
+		{arg: "-vo", consumesValue: true},
+		{arg: "-name", consumesValue: true},
+		{arg: "--output", consumesValue: true},
+		{arg: "--output=/etc/shadow", value: "/etc/shadow", attached: true},
+		{arg: "--any"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			consumesValue, value, attached, err := checkFlag(tt.arg, policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if consumesValue != tt.consumesValue || value != tt.value || attached != tt.attached {
+				t.Fatalf("got (%v, %q, %v), want (%v, %q, %v)", consumesValue, value, attached, tt.consumesValue, tt.value, tt.attached)
+			}
+		})
+	}
+}
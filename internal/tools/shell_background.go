@@ -0,0 +1,476 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/sandbox"
+)
+
+const (
+	// defaultMaxBackgroundProcesses 未配置时同时运行的后台进程上限
+	defaultMaxBackgroundProcesses = 10
+	// defaultBackgroundBufferSize 未配置时每个输出流保留的字节数
+	defaultBackgroundBufferSize = 1 << 20
+	// defaultBackgroundRetention 未配置时已结束进程的保留时间（秒）
+	defaultBackgroundRetention = 3600
+)
+
+// ringBuffer 固定容量的环形缓冲区，只保留最近写入的数据
+// 偏移量按写入的总字节数计算，读取方可以据此增量读取
+// 缓冲区随写入按需增长，输出很少的进程不会占用完整容量
+type ringBuffer struct {
+	mu     sync.Mutex
+	data   []byte
+	size   int
+	end    int
+	length int
+	total  int64
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+// Write 实现io.Writer接口，超出容量时覆盖最早的数据
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+	if len(b.data) < b.size {
+		// 未写满前数据按顺序追加，写满时扩展到完整容量后按环形写入
+		if len(b.data)+n < b.size {
+			b.data = append(b.data, p...)
+			b.end = len(b.data)
+			b.length = len(b.data)
+			return n, nil
+		}
+		grown := make([]byte, b.size)
+		copy(grown, b.data)
+		b.data = grown
+	}
+	if n >= len(b.data) {
+		copy(b.data, p[n-len(b.data):])
+		b.end = 0
+		b.length = len(b.data)
+		return n, nil
+	}
+
+	c := copy(b.data[b.end:], p)
+	copy(b.data, p[c:])
+	b.end = (b.end + n) % len(b.data)
+	b.length = min(b.length+n, len(b.data))
+	return n, nil
+}
+
+// readFrom 读取从offset开始仍保留的数据，返回数据、实际起始偏移和下一个偏移
+func (b *ringBuffer) readFrom(offset int64) ([]byte, int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	first := b.total - int64(b.length)
+	if offset < first {
+		offset = first
+	}
+	if offset > b.total {
+		offset = b.total
+	}
+
+	n := int(b.total - offset)
+	data := make([]byte, n)
+	if n == 0 {
+		return data, offset, b.total
+	}
+	begin := (b.end - n + len(b.data)) % len(b.data)
+	if c := copy(data, b.data[begin:min(begin+n, len(b.data))]); c < n {
+		copy(data[c:], b.data[:n-c])
+	}
+	return data, offset, b.total
+}
+
+// backgroundProcess 一个后台运行的命令
+type backgroundProcess struct {
+	Handle    string
+	Command   []string
+	StartedAt time.Time
+	Owner     string // 启动进程的调用方，未启用认证时为空
+
+	cmd      *exec.Cmd
+	env      *commandEnv
+	stdout   *ringBuffer
+	stderr   *ringBuffer
+	done     chan struct{}
+	mu       sync.Mutex
+	endedAt  time.Time
+	timedOut bool
+}
+
+// processTable 管理后台进程
+type processTable struct {
+	mu        sync.Mutex
+	processes map[string]*backgroundProcess
+}
+
+func newProcessTable() *processTable {
+	return &processTable{processes: make(map[string]*backgroundProcess)}
+}
+
+// start 在登记的进程数未达上限时调用startFn启动进程并登记
+// 保留中的已结束进程同样占用输出缓冲区，因此计入上限，达到上限时先清理最早结束的进程
+func (t *processTable) start(p *backgroundProcess, startFn func() error) error {
+	maxProcesses := config.Get().Tools.ShellExecutor.Background.MaxProcesses
+	if maxProcesses <= 0 {
+		maxProcesses = defaultMaxBackgroundProcesses
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expireLocked()
+	for len(t.processes) >= maxProcesses {
+		if !t.evictOldestLocked() {
+			return fmt.Errorf("maximum number of background processes (%d) reached", maxProcesses)
+		}
+	}
+	if err := startFn(); err != nil {
+		return err
+	}
+	t.processes[p.Handle] = p
+	return nil
+}
+
+// get 获取调用方可以访问的后台进程，同时清理过期的已结束进程
+// 其他调用方的进程视为不存在，拥有shell:admin权限时可以访问所有进程
+func (t *processTable) get(handle string, caller *core.Caller) (*backgroundProcess, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expireLocked()
+	p, exists := t.processes[handle]
+	if !exists || !canAccess(caller, p.Owner) {
+		return nil, fmt.Errorf("process not found: %s", handle)
+	}
+	return p, nil
+}
+
+// expireLocked 清理超过保留时间的已结束进程，调用方需持有锁
+func (t *processTable) expireLocked() {
+	retention := time.Duration(config.Get().Tools.ShellExecutor.Background.Retention) * time.Second
+	if retention <= 0 {
+		retention = defaultBackgroundRetention * time.Second
+	}
+	for handle, p := range t.processes {
+		p.mu.Lock()
+		expired := !p.endedAt.IsZero() && time.Since(p.endedAt) > retention
+		p.mu.Unlock()
+		if expired {
+			delete(t.processes, handle)
+		}
+	}
+}
+
+// evictOldestLocked 移除最早结束的进程，没有已结束的进程时返回false，调用方需持有锁
+func (t *processTable) evictOldestLocked() bool {
+	var oldest string
+	var oldestEnd time.Time
+	for handle, p := range t.processes {
+		p.mu.Lock()
+		endedAt := p.endedAt
+		p.mu.Unlock()
+		if !endedAt.IsZero() && (oldest == "" || endedAt.Before(oldestEnd)) {
+			oldest, oldestEnd = handle, endedAt
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	delete(t.processes, oldest)
+	return true
+}
+
+// closeAll 结束所有运行中的后台进程并等待其退出
+func (t *processTable) closeAll() {
+	t.mu.Lock()
+	processes := make([]*backgroundProcess, 0, len(t.processes))
+	for _, p := range t.processes {
+		processes = append(processes, p)
+	}
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range processes {
+		if !p.running() {
+			continue
+		}
+		wg.Add(1)
+		go func(p *backgroundProcess) {
+			defer wg.Done()
+			p.stop()
+			log.Printf("background process %s: stopped on shutdown", p.Handle)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// running 判断进程是否仍在运行
+func (p *backgroundProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop 先发送SIGTERM，宽限期后仍未退出则发送SIGKILL，最多再等待一个宽限期
+func (p *backgroundProcess) stop() {
+	if !p.running() {
+		return
+	}
+	terminateProcessGroup(p.cmd, false)
+	select {
+	case <-p.done:
+	case <-time.After(killGracePeriod()):
+		terminateProcessGroup(p.cmd, true)
+		// 进程处于不可中断状态时SIGKILL也可能无法立即结束它，不无限等待
+		select {
+		case <-p.done:
+		case <-time.After(killGracePeriod()):
+			log.Printf("background process %s: did not exit after SIGKILL", p.Handle)
+		}
+	}
+}
+
+// status 返回进程的当前状态
+func (p *backgroundProcess) status() map[string]interface{} {
+	result := map[string]interface{}{
+		"handle":     p.Handle,
+		"command":    p.Command,
+		"pid":        p.cmd.Process.Pid,
+		"started_at": p.StartedAt,
+		"running":    p.running(),
+	}
+	if p.Owner != "" {
+		result["owner"] = p.Owner
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.endedAt.IsZero() {
+		result["ended_at"] = p.endedAt
+		result["exit_code"] = p.cmd.ProcessState.ExitCode()
+		result["success"] = p.cmd.ProcessState.Success() && !p.timedOut
+		result["timed_out"] = p.timedOut
+		if signal := exitSignal(p.cmd.ProcessState); signal != "" {
+			result["signal"] = signal
+		}
+	}
+	return result
+}
+
+// startBackground 在后台启动命令并返回句柄，timeout参数可选，未设置时不限制运行时间
+// 进程结束后将结果记录到执行历史中
+func (se *ShellExecutor) startBackground(params map[string]interface{}, entry *HistoryEntry) (interface{}, error) {
+	cfg := config.Get().Tools.ShellExecutor
+	timeout := 0
+	if t, ok := params["timeout"].(float64); ok {
+		timeout = int(t)
+	}
+	if timeout > cfg.MaxTimeout {
+		return nil, fmt.Errorf("timeout exceeds maximum allowed value of %d seconds", cfg.MaxTimeout)
+	}
+
+	cmd, env, err := se.prepareCommand(params, nil, entry.caller)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := parseStdin(params)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = stdin
+
+	bufferSize := cfg.Background.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBackgroundBufferSize
+	}
+	p := &backgroundProcess{
+		Handle:    fmt.Sprintf("proc_%d", time.Now().UnixNano()),
+		Command:   cmd.Args,
+		StartedAt: time.Now(),
+		Owner:     entry.Caller,
+		cmd:       cmd,
+		env:       env,
+		stdout:    newRingBuffer(bufferSize),
+		stderr:    newRingBuffer(bufferSize),
+		done:      make(chan struct{}),
+	}
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	// 命令退出后，残留子进程持有的输出管道最多再等待一个宽限期
+	cmd.WaitDelay = killGracePeriod()
+
+	entry.setCommand(cmd.Args, cmd.Dir, env)
+	entry.Timeout = timeout
+	setProcessGroup(cmd)
+	cleanup, err := sandbox.Wrap(cmd, cfg.Sandbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare sandbox: %v", err)
+	}
+	entry.StartedAt = p.StartedAt
+	err = se.processes.start(p, func() error {
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start command: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	go func() {
+		cmd.Wait()
+		// 清理命令退出后仍残留在进程组中的子进程
+		terminateProcessGroup(cmd, true)
+		cleanup()
+		p.mu.Lock()
+		p.endedAt = time.Now()
+		p.mu.Unlock()
+		close(p.done)
+		se.recordBackground(p, entry)
+	}()
+
+	if timeout > 0 {
+		go func() {
+			select {
+			case <-p.done:
+			case <-time.After(time.Duration(timeout) * time.Second):
+				p.mu.Lock()
+				p.timedOut = true
+				p.mu.Unlock()
+				p.stop()
+			}
+		}()
+	}
+
+	result := p.status()
+	result["history_id"] = entry.ID
+	return result, nil
+}
+
+// recordBackground 将已结束的后台进程记录到执行历史中
+func (se *ShellExecutor) recordBackground(p *backgroundProcess, entry *HistoryEntry) {
+	p.mu.Lock()
+	entry.DurationMs = p.endedAt.Sub(p.StartedAt).Milliseconds()
+	entry.TimedOut = p.timedOut
+	p.mu.Unlock()
+
+	entry.ExitCode = p.cmd.ProcessState.ExitCode()
+	entry.Success = p.cmd.ProcessState.Success() && !entry.TimedOut
+	entry.Signal = exitSignal(p.cmd.ProcessState)
+	stdout, _, _ := p.stdout.readFrom(0)
+	stderr, _, _ := p.stderr.readFrom(0)
+	entry.setOutput(p.env.redact(string(stdout)), p.env.redact(string(stderr)))
+	se.history.add(entry)
+}
+
+// backgroundProcess 根据handle参数获取调用方可以访问的后台进程
+func (se *ShellExecutor) backgroundProcess(ctx context.Context, params map[string]interface{}) (*backgroundProcess, error) {
+	handle, ok := params["handle"].(string)
+	if !ok || handle == "" {
+		return nil, fmt.Errorf("handle parameter is required")
+	}
+	return se.processes.get(handle, core.CallerFromContext(ctx))
+}
+
+// processLogs 读取后台进程某个输出流中从offset开始仍保留的内容
+func (se *ShellExecutor) processLogs(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	p, err := se.backgroundProcess(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, _ := params["stream"].(string)
+	buffer := p.stdout
+	switch stream {
+	case "", "stdout":
+		stream = "stdout"
+	case "stderr":
+		buffer = p.stderr
+	default:
+		return nil, fmt.Errorf("unsupported stream: %s", stream)
+	}
+
+	offset := int64(0)
+	if o, ok := params["offset"].(float64); ok {
+		offset = int64(o)
+	}
+	data, start, next := buffer.readFrom(offset)
+
+	result := map[string]interface{}{
+		"handle":      p.Handle,
+		"stream":      stream,
+		"offset":      start,
+		"next_offset": next,
+		"dropped":     start > offset,
+		"running":     p.running(),
+	}
+	// 非UTF-8输出以base64返回
+	setOutput("data", data, p.env, result)
+	return result, nil
+}
+
+// signalProcess 向后台进程的进程组发送信号
+func (se *ShellExecutor) signalProcess(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	p, err := se.backgroundProcess(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := params["signal"].(string)
+	if name == "" {
+		name = "TERM"
+	}
+	if !p.running() {
+		return nil, fmt.Errorf("process %s has already exited", p.Handle)
+	}
+
+	sent, err := signalProcessGroup(p.cmd, name)
+	if err != nil {
+		return nil, err
+	}
+	result := p.status()
+	result["signal_sent"] = sent
+	return result, nil
+}
+
+// waitProcess 等待后台进程结束，最多等待timeout秒，超时返回时running为true
+func (se *ShellExecutor) waitProcess(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	p, err := se.backgroundProcess(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	maxTimeout := config.Get().Tools.ShellExecutor.MaxTimeout
+	timeout := 30
+	if t, ok := params["timeout"].(float64); ok {
+		timeout = int(t)
+	}
+	if timeout > maxTimeout {
+		return nil, fmt.Errorf("timeout exceeds maximum allowed value of %d seconds", maxTimeout)
+	}
+
+	select {
+	case <-p.done:
+	case <-time.After(time.Duration(timeout) * time.Second):
+	}
+	return p.status(), nil
+}
@@ -0,0 +1,180 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+const (
+	// defaultCommandPath 未配置时命令使用的PATH
+	defaultCommandPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	// defaultMaxStdinSize 未配置时stdin的最大字节数
+	defaultMaxStdinSize = 1 << 20
+	// redactedSecret 输出中密钥值的替换文本
+	redactedSecret = "******"
+)
+
+// builtinEnvDenylist 无论配置如何都不允许调用方设置的变量，它们会改变可执行文件查找、动态链接或shell行为
+var builtinEnvDenylist = []string{
+	"PATH", "LD_*", "DYLD_*", "BASH_ENV", "ENV", "IFS", "SHELLOPTS", "BASHOPTS", "PS4", "PROMPT_COMMAND",
+}
+
+// matchEnvName 检查变量名是否匹配任一通配符模式
+func matchEnvName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// commandEnv 命令的环境变量及需要从输出中隐藏的密钥值
+type commandEnv struct {
+	vars    []string
+	keys    []string
+	secrets []string
+}
+
+// buildEnv 构建命令的干净环境：固定的PATH、配置中继承的变量、调用方的env参数和注入的密钥
+// 注入的密钥须在environment.secrets中列出，且调用方拥有 secret:<name> 或 secret:* 权限，与解析参数中的密钥引用一致
+func (se *ShellExecutor) buildEnv(params map[string]interface{}, caller *core.Caller) (*commandEnv, error) {
+	cfg := config.Get().Tools.ShellExecutor.Environment
+
+	env := make(map[string]string)
+	env["PATH"] = cfg.Path
+	if env["PATH"] == "" {
+		env["PATH"] = defaultCommandPath
+	}
+	for _, name := range cfg.Inherit {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+
+	if raw, ok := params["env"].(map[string]interface{}); ok {
+		for name, v := range raw {
+			value, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("env value for %s must be a string", name)
+			}
+			if name == "" || strings.ContainsAny(name, "=\x00") || strings.Contains(value, "\x00") {
+				return nil, fmt.Errorf("invalid environment variable: %q", name)
+			}
+			if matchEnvName(builtinEnvDenylist, name) || matchEnvName(cfg.Denylist, name) {
+				return nil, fmt.Errorf("environment variable %s is not allowed", name)
+			}
+			if len(cfg.Allowlist) > 0 && !matchEnvName(cfg.Allowlist, name) {
+				return nil, fmt.Errorf("environment variable %s is not allowed", name)
+			}
+			env[name] = value
+		}
+	}
+
+	result := &commandEnv{}
+	if raw, ok := params["secrets"].(map[string]interface{}); ok && len(raw) > 0 {
+		if se.secrets == nil {
+			return nil, fmt.Errorf("no secret store configured")
+		}
+		for name, v := range raw {
+			secretName, ok := v.(string)
+			if !ok || !contains(cfg.Secrets, secretName) {
+				return nil, fmt.Errorf("secret %v is not allowed", v)
+			}
+			if caller != nil && !caller.HasPermission("secret:"+secretName) && !caller.HasPermission("secret:*") {
+				return nil, fmt.Errorf("secret %s is not permitted", secretName)
+			}
+			if matchEnvName(builtinEnvDenylist, name) {
+				return nil, fmt.Errorf("environment variable %s is not allowed", name)
+			}
+			value, err := se.secrets.Get(secretName)
+			if err != nil {
+				return nil, err
+			}
+			env[name] = value
+			if value != "" {
+				result.secrets = append(result.secrets, value)
+			}
+		}
+	}
+
+	for name, value := range env {
+		result.vars = append(result.vars, name+"="+value)
+		result.keys = append(result.keys, name)
+	}
+	sort.Strings(result.vars)
+	sort.Strings(result.keys)
+	return result, nil
+}
+
+// path 返回命令环境中的PATH
+func (e *commandEnv) path() string {
+	for _, kv := range e.vars {
+		if value, ok := strings.CutPrefix(kv, "PATH="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// lookPath 在给定的PATH中查找可执行文件，包含路径分隔符的名称直接使用
+func lookPath(name, pathEnv string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("executable %s not found in PATH", name)
+}
+
+// redact 将输出中出现的密钥值替换为占位符
+func (e *commandEnv) redact(output string) string {
+	for _, secret := range e.secrets {
+		output = strings.ReplaceAll(output, secret, redactedSecret)
+	}
+	return output
+}
+
+// parseStdin 解析stdin参数，stdin_encoding为base64时先解码
+func parseStdin(params map[string]interface{}) (io.Reader, error) {
+	raw, ok := params["stdin"].(string)
+	if !ok {
+		return nil, nil
+	}
+
+	data := []byte(raw)
+	if encoding, _ := params["stdin_encoding"].(string); encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 stdin: %v", err)
+		}
+		data = decoded
+	} else if encoding != "" && encoding != "text" {
+		return nil, fmt.Errorf("unsupported stdin_encoding: %s", encoding)
+	}
+
+	maxSize := config.Get().Tools.ShellExecutor.MaxStdinSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxStdinSize
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("stdin exceeds maximum allowed size of %d bytes", maxSize)
+	}
+	return bytes.NewReader(data), nil
+}
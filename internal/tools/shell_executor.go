@@ -1,22 +1,44 @@
 package tools
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
-	"strings"
 	"time"
 
 	"gay/plugintools/internal/config"
 	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/sandbox"
+	"gay/plugintools/internal/secrets"
 )
 
+const (
+	// defaultKillGracePeriod 未配置时SIGTERM与SIGKILL之间的默认间隔（秒）
+	defaultKillGracePeriod = 5
+	// shellAdminPermission 访问其他调用方的后台进程和执行历史所需的权限
+	shellAdminPermission = "shell:admin"
+)
+
+// canAccess 检查调用方能否访问owner启动的后台进程或执行记录，未启用认证（caller为nil）时总是允许
+func canAccess(caller *core.Caller, owner string) bool {
+	return caller == nil || caller.ID == owner || caller.HasPermission(shellAdminPermission)
+}
+
 // ShellExecutor Shell命令执行工具
-type ShellExecutor struct{}
+type ShellExecutor struct {
+	secrets   secrets.Store
+	sessions  *sessionRegistry
+	processes *processTable
+	history   *historyStore
+}
 
 // NewShellExecutor 创建新的Shell执行工具实例
 func NewShellExecutor() *ShellExecutor {
-	return &ShellExecutor{}
+	return &ShellExecutor{
+		sessions:  newSessionRegistry(),
+		processes: newProcessTable(),
+		history:   newHistoryStore(),
+	}
 }
 
 // GetInfo 实现Tool接口
@@ -24,20 +46,41 @@ func (se *ShellExecutor) GetInfo() core.ToolInfo {
 	return core.ToolInfo{
 		ID:          "shell-executor",
 		Name:        "Shell Executor",
-		Description: "Execute shell commands with timeout and output capture",
+		Description: "Execute shell commands with timeout and output capture, or run them as managed background processes",
 		Version:     "1.0.0",
 		Category:    "System",
 	}
 }
 
+// OperationTags 实现core.OperationTagger接口，向后台进程发送信号标注为destructive
+func (se *ShellExecutor) OperationTags(operation string, params map[string]interface{}) []string {
+	if operation == "signal" {
+		return []string{core.TagDestructive}
+	}
+	return nil
+}
+
 // GetParams 实现Tool接口
 func (se *ShellExecutor) GetParams() []core.ParamSpec {
 	return []core.ParamSpec{
+		{
+			Name:        "operation",
+			Type:        "string",
+			Required:    false,
+			Default:     "run",
+			Description: "Operation to perform (run, script, start, status, logs, signal, wait, template, templates, history, replay); start launches a background process and returns a handle",
+		},
 		{
 			Name:        "command",
 			Type:        "string",
-			Required:    true,
-			Description: "Shell command to execute",
+			Required:    false,
+			Description: "Command line to execute, split into arguments using POSIX shell quoting rules",
+		},
+		{
+			Name:        "argv",
+			Type:        "array",
+			Required:    false,
+			Description: "Command and arguments as an array of strings, used instead of command when given",
 		},
 		{
 			Name:        "timeout",
@@ -52,21 +95,179 @@ func (se *ShellExecutor) GetParams() []core.ParamSpec {
 			Required:    false,
 			Description: "Working directory for command execution",
 		},
+		{
+			Name:        "env",
+			Type:        "object",
+			Required:    false,
+			Description: "Environment variables for the command; commands start from a clean environment",
+		},
+		{
+			Name:        "secrets",
+			Type:        "object",
+			Required:    false,
+			Description: "Secrets to inject as environment variables, mapping variable name to secret name",
+		},
+		{
+			Name:        "stdin",
+			Type:        "string",
+			Required:    false,
+			Description: "Data written to the command's standard input",
+		},
+		{
+			Name:        "stdin_encoding",
+			Type:        "string",
+			Required:    false,
+			Default:     "text",
+			Description: "Encoding of stdin (text, base64)",
+		},
+		{
+			Name:        "handle",
+			Type:        "string",
+			Required:    false,
+			Description: "Background process handle for status, logs, signal and wait operations",
+		},
+		{
+			Name:        "stream",
+			Type:        "string",
+			Required:    false,
+			Default:     "stdout",
+			Description: "Output stream for logs operation (stdout, stderr)",
+		},
+		{
+			Name:        "offset",
+			Type:        "integer",
+			Required:    false,
+			Default:     0,
+			Description: "Read logs starting at this byte offset, as returned in next_offset",
+		},
+		{
+			Name:        "signal",
+			Type:        "string",
+			Required:    false,
+			Default:     "TERM",
+			Description: "Signal to send for signal operation (e.g. TERM, INT, HUP, KILL)",
+		},
+		{
+			Name:        "script",
+			Type:        "string",
+			Required:    false,
+			Description: "Script source for script operation; requires the shell:script permission",
+		},
+		{
+			Name:        "interpreter",
+			Type:        "string",
+			Required:    false,
+			Description: "Configured interpreter used to run the script (e.g. sh, bash, python)",
+		},
+		{
+			Name:        "template",
+			Type:        "string",
+			Required:    false,
+			Description: "Name of the command template to run for template operation",
+		},
+		{
+			Name:        "args",
+			Type:        "object",
+			Required:    false,
+			Description: "Template parameters for template operation",
+		},
+		{
+			Name:        "history_id",
+			Type:        "string",
+			Required:    false,
+			Description: "History entry ID for history and replay operations",
+		},
+		{
+			Name:        "caller",
+			Type:        "string",
+			Required:    false,
+			Description: "Filter history by caller",
+		},
+		{
+			Name:        "kind",
+			Type:        "string",
+			Required:    false,
+			Description: "Filter history by execution kind (run, script, template, background, session)",
+		},
+		{
+			Name:        "since",
+			Type:        "string",
+			Required:    false,
+			Description: "Only return history entries started at or after this RFC3339 time",
+		},
+		{
+			Name:        "limit",
+			Type:        "integer",
+			Required:    false,
+			Default:     50,
+			Description: "Maximum number of history entries to return",
+		},
+		{
+			Name:        "truncate",
+			Type:        "string",
+			Required:    false,
+			Description: "How to truncate output exceeding the size limit (head, tail, middle); defaults to the configured mode",
+		},
+		{
+			Name:        "spill_path",
+			Type:        "string",
+			Required:    false,
+			Description: "Directory within allowed paths where the full stdout and stderr are also written",
+		},
 	}
 }
 
 // Execute 实现Tool接口
 func (se *ShellExecutor) Execute(params map[string]interface{}) (interface{}, error) {
-	command, ok := params["command"].(string)
-	if !ok || command == "" {
-		return nil, fmt.Errorf("command parameter is required")
+	return se.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext 实现core.ContextTool接口，脚本模式需要根据调用方检查权限
+func (se *ShellExecutor) ExecuteContext(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	operation, _ := params["operation"].(string)
+	switch operation {
+	case "", "run":
+		return se.run(params, nil, newHistoryEntry(ctx, "run"))
+	case "script":
+		return se.runScript(ctx, params)
+	case "start":
+		return se.startBackground(params, newHistoryEntry(ctx, "background"))
+	case "status":
+		p, err := se.backgroundProcess(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return p.status(), nil
+	case "logs":
+		return se.processLogs(ctx, params)
+	case "signal":
+		return se.signalProcess(ctx, params)
+	case "wait":
+		return se.waitProcess(ctx, params)
+	case "template":
+		return se.executeTemplate(ctx, params)
+	case "templates":
+		return se.listTemplates()
+	case "history":
+		return se.queryHistory(ctx, params)
+	case "replay":
+		return se.replay(ctx, params)
+	default:
+		return nil, fmt.Errorf("unsupported operation: %s", operation)
 	}
+}
 
-	// 验证命令是否在允许列表中
-	if !se.isCommandAllowed(command) {
-		return nil, fmt.Errorf("command not allowed: %s", command)
+// run 执行命令并等待其完成，argv的含义与prepareCommand相同
+func (se *ShellExecutor) run(params map[string]interface{}, argv []string, entry *HistoryEntry) (interface{}, error) {
+	cmd, env, err := se.prepareCommand(params, argv, entry.caller)
+	if err != nil {
+		return nil, err
 	}
+	return se.runCommand(cmd, env, params, entry)
+}
 
+// runCommand 启动已准备好的命令，等待其完成或超时，并将执行结果记录到历史中
+func (se *ShellExecutor) runCommand(cmd *exec.Cmd, env *commandEnv, params map[string]interface{}, entry *HistoryEntry) (interface{}, error) {
 	timeout := 30
 	if t, ok := params["timeout"].(float64); ok {
 		timeout = int(t)
@@ -78,57 +279,172 @@ func (se *ShellExecutor) Execute(params map[string]interface{}) (interface{}, er
 		return nil, fmt.Errorf("timeout exceeds maximum allowed value of %d seconds", cfg.Tools.ShellExecutor.MaxTimeout)
 	}
 
-	workingDir, _ := params["working_dir"].(string)
+	stdin, err := parseStdin(params)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = stdin
 
-	// 创建命令
-	parts := strings.Fields(command)
-	cmd := exec.Command(parts[0], parts[1:]...)
-	if workingDir != "" {
-		cmd.Dir = workingDir
+	// 捕获输出，超出上限时截断
+	stdout, stderr, err := outputCaptures(params, env)
+	if err != nil {
+		return nil, err
 	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	defer stdout.closeSpill()
+	defer stderr.closeSpill()
+	// 命令退出后，残留子进程持有的输出管道最多再等待一个宽限期
+	cmd.WaitDelay = killGracePeriod()
 
-	// 捕获输出
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	entry.setCommand(cmd.Args, cmd.Dir, env)
+	entry.Timeout = timeout
+	setProcessGroup(cmd)
+
+	// 按配置应用资源限制和隔离
+	cleanup, err := sandbox.Wrap(cmd, cfg.Tools.ShellExecutor.Sandbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare sandbox: %v", err)
+	}
+	defer cleanup()
 
 	// 启动命令
+	entry.StartedAt = time.Now()
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start command: %v", err)
 	}
 
-	// 设置超时
 	done := make(chan error, 1)
 	go func() {
 		done <- cmd.Wait()
 	}()
 
-	// 等待命令完成或超时
-	var err error
+	// 等待命令完成或超时，超时后先发送SIGTERM，宽限期后仍未退出则发送SIGKILL
+	timedOut := false
+	signal := ""
 	select {
 	case err = <-done:
 	case <-time.After(time.Duration(timeout) * time.Second):
-		if err = cmd.Process.Kill(); err != nil {
-			return nil, fmt.Errorf("failed to kill process: %v", err)
+		timedOut = true
+		if signal, err = terminateProcessGroup(cmd, false); err != nil {
+			return nil, fmt.Errorf("failed to terminate process: %v", err)
+		}
+		select {
+		case err = <-done:
+		case <-time.After(killGracePeriod()):
+			if signal, err = terminateProcessGroup(cmd, true); err != nil {
+				return nil, fmt.Errorf("failed to kill process: %v", err)
+			}
+			// 进程处于不可中断状态时SIGKILL也可能无法立即结束它，不无限等待
+			select {
+			case err = <-done:
+			case <-time.After(killGracePeriod()):
+				err = fmt.Errorf("process did not exit after SIGKILL")
+			}
 		}
-		return nil, fmt.Errorf("command timed out after %d seconds", timeout)
 	}
 
-	// 返回结果
+	// 清理命令退出后仍残留在进程组中的子进程
+	terminateProcessGroup(cmd, true)
+
+	if !timedOut {
+		signal = exitSignal(cmd.ProcessState)
+	}
+
+	// 返回结果，超时时包含已捕获的部分输出
 	result := map[string]interface{}{
 		"exit_code": cmd.ProcessState.ExitCode(),
-		"stdout":    stdout.String(),
-		"stderr":    stderr.String(),
-		"success":   err == nil,
+		"success":   err == nil && !timedOut,
+		"timed_out": timedOut,
+	}
+	stdout.result("stdout", env, result)
+	stderr.result("stderr", env, result)
+	if signal != "" {
+		result["signal"] = signal
 	}
+	for name, capture := range map[string]*outputCapture{"stdout": stdout, "stderr": stderr} {
+		path, err := capture.closeSpill()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s spill file: %v", name, err)
+		}
+		if path != "" {
+			result[name+"_file"] = path
+		}
+	}
+
+	entry.DurationMs = time.Since(entry.StartedAt).Milliseconds()
+	entry.ExitCode = cmd.ProcessState.ExitCode()
+	entry.Success = result["success"].(bool)
+	entry.Signal = signal
+	entry.TimedOut = timedOut
+	stdoutText, _ := result["stdout"].(string)
+	stderrText, _ := result["stderr"].(string)
+	entry.setOutput(stdoutText, stderrText)
+	se.history.add(entry)
+	result["history_id"] = entry.ID
 
 	return result, nil
 }
 
+// prepareCommand 校验命令、参数和环境变量并创建尚未启动的命令
+// argv不为nil时是由命令模板展开的命令，模板由管理员定义，不再检查允许列表和参数策略
+// caller为执行命令的调用方，未启用认证时为nil
+func (se *ShellExecutor) prepareCommand(params map[string]interface{}, argv []string, caller *core.Caller) (*exec.Cmd, *commandEnv, error) {
+	workingDir, _ := params["working_dir"].(string)
+
+	if argv == nil {
+		var err error
+		if argv, err = parseArgv(params); err != nil {
+			return nil, nil, err
+		}
+
+		// 验证命令是否在允许列表中
+		if !se.isCommandAllowed(argv[0]) {
+			return nil, nil, fmt.Errorf("command not allowed: %s", argv[0])
+		}
+
+		// 按命令的参数策略校验参数
+		if err := checkArguments(argv, workingDir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	env, err := se.buildEnv(params, caller)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 创建命令，在命令自己的PATH中查找可执行文件
+	path, err := lookPath(argv[0], env.path())
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Args[0] = argv[0]
+	cmd.Env = env.vars
+	if workingDir != "" {
+		cmd.Dir = workingDir
+	}
+	return cmd, env, nil
+}
+
+// SetSecretStore 设置密钥存储，secrets参数从中读取密钥注入到环境变量
+func (se *ShellExecutor) SetSecretStore(store secrets.Store) {
+	se.secrets = store
+}
+
+// killGracePeriod 返回SIGTERM之后等待进程退出的时间
+func killGracePeriod() time.Duration {
+	grace := config.Get().Tools.ShellExecutor.KillGracePeriod
+	if grace <= 0 {
+		grace = defaultKillGracePeriod
+	}
+	return time.Duration(grace) * time.Second
+}
+
 // isCommandAllowed 检查命令是否在允许列表中
-func (se *ShellExecutor) isCommandAllowed(command string) bool {
+func (se *ShellExecutor) isCommandAllowed(cmdName string) bool {
 	cfg := config.Get()
-	cmdName := strings.Fields(command)[0]
 
 	for _, allowed := range cfg.Tools.ShellExecutor.AllowedCommands {
 		if cmdName == allowed {
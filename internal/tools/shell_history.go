@@ -0,0 +1,396 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gay/plugintools/internal/auth"
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+	"gay/plugintools/internal/secrets"
+)
+
+const (
+	// defaultHistoryEntries 未配置时保留的历史记录条数
+	defaultHistoryEntries = 1000
+	// defaultHistoryOutput 未配置时每条历史记录保留的输出字节数
+	defaultHistoryOutput = 4096
+	// defaultHistoryLimit 查询历史时默认返回的条数
+	defaultHistoryLimit = 50
+)
+
+// HistoryEntry 一次命令执行的记录
+type HistoryEntry struct {
+	ID           string                 `json:"id"`
+	Kind         string                 `json:"kind"` // run, script, template, background, session
+	Caller       string                 `json:"caller,omitempty"`
+	Argv         []string               `json:"argv"`
+	WorkingDir   string                 `json:"working_dir,omitempty"`
+	EnvKeys      []string               `json:"env_keys,omitempty"`
+	Template     string                 `json:"template,omitempty"`
+	Args         map[string]interface{} `json:"args,omitempty"`
+	ScriptSHA256 string                 `json:"script_sha256,omitempty"`
+	ReplayOf     string                 `json:"replay_of,omitempty"`
+	Timeout      int                    `json:"timeout,omitempty"`
+	StartedAt    time.Time              `json:"started_at"`
+	DurationMs   int64                  `json:"duration_ms"`
+	ExitCode     int                    `json:"exit_code"`
+	Success      bool                   `json:"success"`
+	Signal       string                 `json:"signal,omitempty"`
+	TimedOut     bool                   `json:"timed_out,omitempty"`
+	Stdout       string                 `json:"stdout,omitempty"`
+	Stderr       string                 `json:"stderr,omitempty"`
+	Truncated    bool                   `json:"truncated,omitempty"`
+
+	unresolved map[string]interface{} // 解析密钥引用之前的调用参数
+	caller     *core.Caller           // 执行命令的调用方，用于检查注入密钥的权限
+}
+
+// newHistoryEntry 创建历史记录，调用方取自context
+func newHistoryEntry(ctx context.Context, kind string) *HistoryEntry {
+	entry := &HistoryEntry{
+		ID:         fmt.Sprintf("exec_%d", time.Now().UnixNano()),
+		Kind:       kind,
+		StartedAt:  time.Now(),
+		unresolved: core.UnresolvedParamsFromContext(ctx),
+		caller:     core.CallerFromContext(ctx),
+	}
+	if caller := core.CallerFromContext(ctx); caller != nil {
+		entry.Caller = caller.ID
+	}
+	return entry
+}
+
+// setCommand 记录命令、工作目录和环境变量名，需在沙箱改写命令之前调用
+// 参数中的密钥引用按原样记录，不保存解析后的密钥值
+func (e *HistoryEntry) setCommand(argv []string, workingDir string, env *commandEnv) {
+	e.Argv = append([]string(nil), argv...)
+	if e.Kind == "run" || e.Kind == "background" {
+		if raw, err := parseArgv(e.unresolved); err == nil && len(raw) == len(argv) {
+			for i, arg := range raw {
+				if arg != argv[i] && strings.Contains(arg, "${secret:") {
+					e.Argv[i] = arg
+				}
+			}
+		}
+	}
+	e.WorkingDir = workingDir
+	e.EnvKeys = env.keys
+}
+
+// setOutput 记录截断后的输出
+func (e *HistoryEntry) setOutput(stdout, stderr string) {
+	maxOutput := config.Get().Tools.ShellExecutor.History.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = defaultHistoryOutput
+	}
+	truncate := func(s string) string {
+		if len(s) <= maxOutput {
+			return s
+		}
+		e.Truncated = true
+		return strings.ToValidUTF8(s[:maxOutput], "")
+	}
+	e.Stdout = truncate(stdout)
+	e.Stderr = truncate(stderr)
+}
+
+// setArgs 记录模板参数，优先使用解析密钥引用之前的参数
+func (e *HistoryEntry) setArgs(args, unresolved map[string]interface{}) {
+	e.Args = args
+	if unresolved != nil {
+		e.Args = unresolved
+	}
+}
+
+// redact 隐藏记录中出现的已知密钥值，密钥引用本身不受影响
+func (e *HistoryEntry) redact() {
+	for i, arg := range e.Argv {
+		e.Argv[i] = secrets.Redact(arg)
+	}
+	e.Args = secrets.RedactParams(e.Args)
+	e.WorkingDir = secrets.Redact(e.WorkingDir)
+	e.Stdout = secrets.Redact(e.Stdout)
+	e.Stderr = secrets.Redact(e.Stderr)
+}
+
+// historyStore 保存最近的执行记录，配置了文件时同时追加写入JSON Lines文件
+type historyStore struct {
+	mu      sync.Mutex
+	entries []*HistoryEntry
+	file    *os.File
+}
+
+func newHistoryStore() *historyStore {
+	return &historyStore{}
+}
+
+// maxEntries 返回保留的记录条数
+func (h *historyStore) maxEntries() int {
+	maxEntries := config.Get().Tools.ShellExecutor.History.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultHistoryEntries
+	}
+	return maxEntries
+}
+
+// open 从文件加载历史记录，只保留最近的记录并重写文件，之后的记录追加到该文件
+func (h *historyStore) open(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %v", err)
+	}
+
+	var entries []*HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read history file: %v", err)
+	}
+	if n := h.maxEntries(); len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+
+	// 压缩文件，只保留加载的记录
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to compact history file: %v", err)
+	}
+	f.Seek(0, 0)
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		enc.Encode(entry)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to compact history file: %v", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = entries
+	h.file = f
+	return nil
+}
+
+// add 隐藏密钥值后保存一条记录
+func (h *historyStore) add(entry *HistoryEntry) {
+	entry.redact()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, entry)
+	if n := h.maxEntries(); len(h.entries) > n {
+		h.entries = append([]*HistoryEntry(nil), h.entries[len(h.entries)-n:]...)
+	}
+	if h.file != nil {
+		data, _ := json.Marshal(entry)
+		if _, err := h.file.Write(append(data, '\n')); err != nil {
+			log.Printf("shell history: failed to write %s: %v", entry.ID, err)
+		}
+	}
+}
+
+// get 根据ID获取调用方可以访问的记录，其他调用方的记录视为不存在
+func (h *historyStore) get(id string, caller *core.Caller) (*HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, entry := range h.entries {
+		if entry.ID == id && canAccess(caller, entry.Caller) {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("history entry not found: %s", id)
+}
+
+// query 按条件查询记录，最新的在前
+func (h *historyStore) query(caller, kind, command string, since time.Time, limit int) []*HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]*HistoryEntry, 0, min(limit, len(h.entries)))
+	for i := len(h.entries) - 1; i >= 0 && len(result) < limit; i-- {
+		entry := h.entries[i]
+		if caller != "" && entry.Caller != caller {
+			continue
+		}
+		if kind != "" && entry.Kind != kind {
+			continue
+		}
+		if command != "" && (len(entry.Argv) == 0 || entry.Argv[0] != command) {
+			continue
+		}
+		if entry.StartedAt.Before(since) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// close 关闭历史文件
+func (h *historyStore) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+}
+
+// OpenHistory 从文件加载执行历史，之后的执行记录追加到该文件
+func (se *ShellExecutor) OpenHistory(path string) error {
+	return se.history.open(path)
+}
+
+// queryHistory 处理history操作，指定history_id时返回单条记录，否则按caller、kind、command、since过滤
+// 只能查询自己的记录，拥有shell:admin权限时可以查询所有调用方的记录
+func (se *ShellExecutor) queryHistory(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	requester := core.CallerFromContext(ctx)
+	if id, _ := params["history_id"].(string); id != "" {
+		return se.history.get(id, requester)
+	}
+
+	caller, _ := params["caller"].(string)
+	if requester != nil && !requester.HasPermission(shellAdminPermission) {
+		if caller != "" && caller != requester.ID {
+			return nil, fmt.Errorf("permission %s is required to query history of other callers", shellAdminPermission)
+		}
+		caller = requester.ID
+	}
+	kind, _ := params["kind"].(string)
+	command, _ := params["command"].(string)
+	var since time.Time
+	if s, ok := params["since"].(string); ok && s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %v", err)
+		}
+		since = t
+	}
+	limit := defaultHistoryLimit
+	if l, ok := params["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+	return se.history.query(caller, kind, command, since, limit), nil
+}
+
+// replay 重新执行一条历史记录，命令仍需通过当前的允许列表、参数策略和沙箱，
+// 并按原始执行对应的操作（run、start、template）重新授权和检查策略
+// 历史中不保存环境变量值和stdin，可在本次请求中通过env、secrets、stdin重新提供
+// 记录中的密钥引用按重放调用方的权限重新解析
+func (se *ShellExecutor) replay(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	id, _ := params["history_id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("history_id parameter is required")
+	}
+	caller := core.CallerFromContext(ctx)
+	original, err := se.history.get(id, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	replayParams := map[string]interface{}{
+		"working_dir": original.WorkingDir,
+	}
+	// 重新提供的参数整体重新解析，使用解析密钥引用之前的值
+	provided := params
+	if unresolved := core.UnresolvedParamsFromContext(ctx); unresolved != nil {
+		provided = unresolved
+	}
+	for _, name := range []string{"env", "secrets", "stdin", "stdin_encoding", "truncate", "spill_path"} {
+		if v, ok := provided[name]; ok {
+			replayParams[name] = v
+		}
+	}
+	if original.Timeout > 0 {
+		replayParams["timeout"] = float64(original.Timeout)
+	}
+	if t, ok := params["timeout"]; ok {
+		replayParams["timeout"] = t
+	}
+
+	switch original.Kind {
+	case "run", "background":
+		argv := make([]interface{}, len(original.Argv))
+		for i, arg := range original.Argv {
+			argv[i] = arg
+		}
+		replayParams["argv"] = argv
+		replayParams["operation"] = "run"
+		if original.Kind == "background" {
+			replayParams["operation"] = "start"
+		}
+		if err := se.authorizeReplay(caller, replayParams); err != nil {
+			return nil, err
+		}
+		execParams, err := auth.ResolveSecrets(caller, replayParams)
+		if err != nil {
+			return nil, err
+		}
+		entry := newHistoryEntry(core.WithUnresolvedParams(ctx, replayParams), original.Kind)
+		entry.ReplayOf = original.ID
+		if original.Kind == "background" {
+			return se.startBackground(execParams, entry)
+		}
+		return se.run(execParams, nil, entry)
+	case "template":
+		templateParams := map[string]interface{}{
+			"operation": "template",
+			"template":  original.Template,
+			"args":      original.Args,
+		}
+		if err := se.authorizeReplay(caller, templateParams); err != nil {
+			return nil, err
+		}
+		args, err := auth.ResolveSecrets(caller, original.Args)
+		if err != nil {
+			return nil, err
+		}
+		t, err := se.template(original.Template)
+		if err != nil {
+			return nil, err
+		}
+		entry := newHistoryEntry(core.WithUnresolvedParams(ctx, templateParams), "template")
+		entry.ReplayOf = original.ID
+		entry.setArgs(args, original.Args)
+		return se.runTemplate(t, args, entry)
+	default:
+		return nil, fmt.Errorf("%s executions cannot be replayed", original.Kind)
+	}
+}
+
+// authorizeReplay 按重放的操作和参数检查角色授权、审批规则和策略，与服务器对直接调用的检查一致
+// 需要审批的操作不能通过重放执行
+func (se *ShellExecutor) authorizeReplay(caller *core.Caller, params map[string]interface{}) error {
+	toolID := se.GetInfo().ID
+	operation := auth.Operation(se, params)
+	if !auth.Authorize(caller, toolID, operation) {
+		return fmt.Errorf("operation %s of %s is not permitted", operation, toolID)
+	}
+	if auth.RequiresApproval(se, operation, params) {
+		return fmt.Errorf("operation %s of %s requires approval and cannot be replayed", operation, toolID)
+	}
+	decision := policy.Check(policy.Input{Caller: caller, ToolID: toolID, Operation: operation, Params: params})
+	if !decision.Allowed {
+		return fmt.Errorf("%s of %s denied by policy %s: %s", operation, toolID, decision.Policy, decision.Reason)
+	}
+	return nil
+}
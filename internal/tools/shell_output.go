@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gay/plugintools/internal/config"
+)
+
+// defaultMaxOutputSize 未配置时每个输出流返回的最大字节数
+const defaultMaxOutputSize = 1 << 20
+
+// outputCapture 有上限的输出捕获，按截断模式保留开头和/或结尾的数据，可同时将完整输出写入文件
+type outputCapture struct {
+	headLimit int
+	head      []byte
+	tail      *ringBuffer
+	total     int64
+	spill     *os.File
+	spillErr  error
+	// 进程未能结束时命令可能在返回结果后仍在写入
+	mu sync.Mutex
+}
+
+// newOutputCapture 创建输出捕获，mode为 head（保留开头）、tail（保留结尾）或 middle（保留两端）
+func newOutputCapture(limit int, mode string) (*outputCapture, error) {
+	c := &outputCapture{}
+	switch mode {
+	case "head":
+		c.headLimit = limit
+	case "tail":
+		c.tail = newRingBuffer(limit)
+	case "", "middle":
+		c.headLimit = limit / 2
+		if limit-c.headLimit > 0 {
+			c.tail = newRingBuffer(limit - c.headLimit)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported truncate mode: %s", mode)
+	}
+	return c, nil
+}
+
+// Write 实现io.Writer接口，超出上限的数据只写入溢出文件
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total += int64(len(p))
+	if c.spill != nil && c.spillErr == nil {
+		_, c.spillErr = c.spill.Write(p)
+	}
+
+	rest := p
+	if n := min(c.headLimit-len(c.head), len(rest)); n > 0 {
+		c.head = append(c.head, rest[:n]...)
+		rest = rest[n:]
+	}
+	if len(rest) > 0 && c.tail != nil {
+		c.tail.Write(rest)
+	}
+	return len(p), nil
+}
+
+// result 将捕获的输出写入结果，键名以name为前缀
+// 合法UTF-8输出以文本返回并在截断处插入标记，否则以base64返回并设置 <name>_encoding
+func (c *outputCapture) result(name string, env *commandEnv, result map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var tail []byte
+	if c.tail != nil {
+		tail, _, _ = c.tail.readFrom(0)
+	}
+	omitted := c.total - int64(len(c.head)) - int64(len(tail))
+
+	if omitted == 0 {
+		setOutput(name, append(c.head, tail...), env, result)
+		return
+	}
+
+	result[name+"_truncated"] = true
+	result[name+"_bytes"] = c.total
+
+	// 截断处可能切开多字节字符，文本输出时去掉不完整的部分
+	textHead, textTail := trimPartialRunes(c.head, tail)
+	if utf8.Valid(textHead) && utf8.Valid(textTail) {
+		marker := fmt.Sprintf("\n... [%d bytes truncated] ...\n", c.total-int64(len(textHead))-int64(len(textTail)))
+		result[name] = env.redact(string(textHead) + marker + string(textTail))
+		return
+	}
+	setOutput(name, append(c.head, tail...), env, result)
+}
+
+// setOutput 以文本或base64写入输出
+func setOutput(name string, data []byte, env *commandEnv, result map[string]interface{}) {
+	text := env.redact(string(data))
+	if utf8.ValidString(text) {
+		result[name] = text
+		return
+	}
+	result[name] = base64.StdEncoding.EncodeToString([]byte(text))
+	result[name+"_encoding"] = "base64"
+}
+
+// trimPartialRunes 去掉head末尾和tail开头被截断的UTF-8字符片段
+func trimPartialRunes(head, tail []byte) ([]byte, []byte) {
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) {
+				head = head[:i]
+			}
+			break
+		}
+	}
+	for i := 0; i < len(tail) && i < utf8.UTFMax; i++ {
+		if utf8.RuneStart(tail[i]) {
+			tail = tail[i:]
+			break
+		}
+	}
+	return head, tail
+}
+
+// outputCaptures 根据配置和参数为stdout和stderr创建输出捕获
+// spill_path 指定允许路径内的目录时，完整输出另外写入该目录下的文件
+func outputCaptures(params map[string]interface{}, env *commandEnv) (*outputCapture, *outputCapture, error) {
+	cfg := config.Get().Tools.ShellExecutor.Output
+	limit := cfg.MaxSize
+	if limit <= 0 {
+		limit = defaultMaxOutputSize
+	}
+	mode, ok := params["truncate"].(string)
+	if !ok {
+		mode = cfg.Truncate
+	}
+
+	stdout, err := newOutputCapture(limit, mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, _ := newOutputCapture(limit, mode)
+
+	spillPath, _ := params["spill_path"].(string)
+	if spillPath == "" {
+		return stdout, stderr, nil
+	}
+	if len(env.secrets) > 0 {
+		return nil, nil, fmt.Errorf("spill_path cannot be used together with secrets")
+	}
+	if !isAllowedPath(spillPath) {
+		return nil, nil, fmt.Errorf("access to path %s is not allowed", spillPath)
+	}
+	if info, err := os.Stat(spillPath); err != nil || !info.IsDir() {
+		return nil, nil, fmt.Errorf("spill_path %s is not a directory", spillPath)
+	}
+
+	prefix := filepath.Join(spillPath, fmt.Sprintf("shell_%d", time.Now().UnixNano()))
+	if stdout.spill, err = os.OpenFile(prefix+".stdout", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to create spill file: %v", err)
+	}
+	if stderr.spill, err = os.OpenFile(prefix+".stderr", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+		stdout.closeSpill()
+		return nil, nil, fmt.Errorf("failed to create spill file: %v", err)
+	}
+	return stdout, stderr, nil
+}
+
+// closeSpill 关闭溢出文件，返回文件路径和写入过程中的错误，可重复调用
+func (c *outputCapture) closeSpill() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spill == nil {
+		return "", nil
+	}
+	name := c.spill.Name()
+	err := c.spill.Close()
+	if c.spillErr != nil {
+		err = c.spillErr
+	}
+	c.spill = nil
+	return name, err
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup 非Unix平台不支持进程组
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// setSessionLeader 非Unix平台不支持会话和控制终端
+func setSessionLeader(cmd *exec.Cmd) {}
+
+// terminateProcessGroup 非Unix平台没有信号，直接结束进程
+func terminateProcessGroup(cmd *exec.Cmd, force bool) (string, error) {
+	return "KILL", cmd.Process.Kill()
+}
+
+// signalProcessGroup 非Unix平台只支持结束进程
+func signalProcessGroup(cmd *exec.Cmd, name string) (string, error) {
+	if name != "KILL" && name != "SIGKILL" {
+		return "", fmt.Errorf("unsupported signal: %s", name)
+	}
+	return "KILL", cmd.Process.Kill()
+}
+
+// exitSignal 非Unix平台不报告信号
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
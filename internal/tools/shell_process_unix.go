@@ -0,0 +1,75 @@
+//go:build unix
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup 让命令在独立的进程组中运行，以便终止时一并结束其子进程
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setSessionLeader 让命令成为新会话的首进程并以其stdin作为控制终端，用于在PTY中运行
+// 会话首进程同时也是新进程组的组长，因此terminateProcessGroup同样适用
+func setSessionLeader(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+}
+
+// terminateProcessGroup 向命令所在的进程组发送SIGTERM，force为true时发送SIGKILL
+// 返回发送的信号名称，进程组已不存在时不视为错误
+func terminateProcessGroup(cmd *exec.Cmd, force bool) (string, error) {
+	sig := unix.SIGTERM
+	if force {
+		sig = unix.SIGKILL
+	}
+	err := unix.Kill(-cmd.Process.Pid, sig)
+	if errors.Is(err, unix.ESRCH) {
+		err = nil
+	}
+	return unix.SignalName(sig), err
+}
+
+// signalProcessGroup 向命令所在的进程组发送指定名称的信号（如 TERM、SIGINT）
+func signalProcessGroup(cmd *exec.Cmd, name string) (string, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return "", fmt.Errorf("unsupported signal: %s", name)
+	}
+	err := unix.Kill(-cmd.Process.Pid, sig)
+	if errors.Is(err, unix.ESRCH) {
+		err = fmt.Errorf("process has already exited")
+	}
+	return name, err
+}
+
+// exitSignal 返回导致进程退出的信号名称，正常退出时返回空字符串
+func exitSignal(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	return unix.SignalName(status.Signal())
+}
@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/sandbox"
+)
+
+const (
+	// scriptPermission 使用脚本模式所需的权限
+	scriptPermission = "shell:script"
+	// defaultMaxScriptSize 未配置时脚本的最大字节数
+	defaultMaxScriptSize = 64 << 10
+)
+
+// runScript 将脚本写入临时文件后用配置的解释器执行
+// 脚本同样经过沙箱、超时和输出限制，命令本身不受允许列表和参数策略限制，因此要求启用沙箱且调用方拥有shell:script权限
+func (se *ShellExecutor) runScript(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	caller := core.CallerFromContext(ctx)
+	cfg := config.Get().Tools.ShellExecutor
+	if !cfg.Script.Enabled {
+		return nil, fmt.Errorf("script mode is disabled")
+	}
+	// 脚本不受允许列表和参数策略限制，没有沙箱的资源限制和隔离时不允许运行
+	if !cfg.Sandbox.Enabled {
+		return nil, fmt.Errorf("script mode requires shell_executor.sandbox to be enabled")
+	}
+	if !caller.HasPermission(scriptPermission) {
+		return nil, fmt.Errorf("permission %s is required to run scripts", scriptPermission)
+	}
+
+	script, ok := params["script"].(string)
+	if !ok || script == "" {
+		return nil, fmt.Errorf("script parameter is required")
+	}
+	maxSize := cfg.Script.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxScriptSize
+	}
+	if int64(len(script)) > maxSize {
+		return nil, fmt.Errorf("script exceeds maximum allowed size of %d bytes", maxSize)
+	}
+
+	name, _ := params["interpreter"].(string)
+	interpreter, ok := cfg.Script.Interpreters[name]
+	if !ok || len(interpreter) == 0 {
+		return nil, fmt.Errorf("unsupported interpreter: %s", name)
+	}
+
+	path, err := writeScriptFile(script, cfg.Sandbox)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+
+	argv := append(append([]string{}, interpreter...), path)
+	cmd, env, err := se.prepareCommand(params, argv, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(script))
+	hash := hex.EncodeToString(sum[:])
+	log.Printf("shell script: caller=%s interpreter=%s sha256=%s size=%d", caller.ID, name, hash, len(script))
+
+	entry := newHistoryEntry(ctx, "script")
+	entry.ScriptSHA256 = hash
+	result, err := se.runCommand(cmd, env, params, entry)
+	if err != nil {
+		return nil, err
+	}
+	result.(map[string]interface{})["script_sha256"] = hash
+	return result, nil
+}
+
+// writeScriptFile 将脚本写入只有运行用户可读的临时文件，沙箱以其他用户运行时转交文件所有权
+func writeScriptFile(script string, sandboxCfg config.SandboxConfig) (string, error) {
+	f, err := os.CreateTemp("", "plugintools-script-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create script file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(script); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write script file: %v", err)
+	}
+
+	uid, gid, ok, err := sandbox.RunAsIDs(sandboxCfg)
+	if err == nil && ok {
+		err = f.Chown(uid, gid)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to prepare script file: %v", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,388 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gorilla/websocket"
+
+	"gay/plugintools/internal/auth"
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+	"gay/plugintools/internal/policy"
+	"gay/plugintools/internal/sandbox"
+)
+
+const (
+	// defaultSessionIdleTimeout 未配置时会话的空闲超时（秒）
+	defaultSessionIdleTimeout = 600
+	// defaultMaxSessions 未配置时同时打开的会话上限
+	defaultMaxSessions = 10
+	// sessionStartTimeout 连接建立后等待start消息的时间
+	sessionStartTimeout = 30 * time.Second
+	// sessionWriteTimeout 向客户端写入单条消息的超时
+	sessionWriteTimeout = 10 * time.Second
+	// defaultSessionTerm 调用方未设置TERM时使用的终端类型
+	defaultSessionTerm = "xterm-256color"
+)
+
+// sessionMessage 会话中的控制消息
+// 客户端发送 start、input、resize，服务器发送 started、exit、error；终端输出以二进制消息发送
+type sessionMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Cols      uint16 `json:"cols,omitempty"`
+	Rows      uint16 `json:"rows,omitempty"`
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	Signal    string `json:"signal,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// shellSession 一个交互式PTY会话
+type shellSession struct {
+	ID        string
+	Command   []string
+	Remote    string
+	StartedAt time.Time
+
+	cmd      *exec.Cmd
+	env      *commandEnv
+	pty      *os.File
+	cleanup  sandbox.Cleanup
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	activity atomic.Int64
+	closing  chan struct{}
+	once     sync.Once
+}
+
+// sessionRegistry 正在运行的交互会话
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*shellSession
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: make(map[string]*shellSession)}
+}
+
+// add 登记会话，超过上限时返回错误
+func (r *sessionRegistry) add(s *shellSession) error {
+	maxSessions := config.Get().Tools.ShellExecutor.Sessions.MaxSessions
+	if maxSessions <= 0 {
+		maxSessions = defaultMaxSessions
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.sessions) >= maxSessions {
+		return fmt.Errorf("maximum number of sessions (%d) reached", maxSessions)
+	}
+	r.sessions[s.ID] = s
+	return nil
+}
+
+// remove 移除会话
+func (r *sessionRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.sessions, id)
+	r.mu.Unlock()
+}
+
+// closeAll 通知所有会话结束
+func (r *sessionRegistry) closeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		s.close()
+	}
+}
+
+// close 通知会话结束，可重复调用
+func (s *shellSession) close() {
+	s.once.Do(func() { close(s.closing) })
+}
+
+// touch 记录一次输入或输出
+func (s *shellSession) touch() {
+	s.activity.Store(time.Now().UnixNano())
+}
+
+// idleFor 返回距上次输入或输出的时间
+func (s *shellSession) idleFor() time.Duration {
+	return time.Since(time.Unix(0, s.activity.Load()))
+}
+
+// writeMessage 串行地向连接写入消息，客户端长时间不读取时写入失败
+func (s *shellSession) writeMessage(messageType int, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(sessionWriteTimeout))
+	return s.conn.WriteMessage(messageType, data)
+}
+
+// writeControl 向连接写入控制消息
+func (s *shellSession) writeControl(msg sessionMessage) error {
+	data, _ := json.Marshal(msg)
+	return s.writeMessage(websocket.TextMessage, data)
+}
+
+var sessionUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// handleSession 在WebSocket连接上运行交互式PTY会话
+// 连接建立后客户端先发送start消息，其余字段与Execute的参数相同（command/argv、working_dir、env、secrets），
+// 另可携带cols和rows指定终端大小
+func (se *ShellExecutor) handleSession(w http.ResponseWriter, r *http.Request) {
+	if !config.Get().Tools.ShellExecutor.Sessions.Enabled {
+		http.Error(w, "interactive sessions are disabled", http.StatusForbidden)
+		return
+	}
+
+	conn, err := sessionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s := &shellSession{
+		ID:        fmt.Sprintf("session_%d", time.Now().UnixNano()),
+		Remote:    r.RemoteAddr,
+		StartedAt: time.Now(),
+		conn:      conn,
+		closing:   make(chan struct{}),
+	}
+	if err := se.startSession(s, core.CallerFromContext(r.Context())); err != nil {
+		s.writeControl(sessionMessage{Type: "error", Error: err.Error()})
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		return
+	}
+	defer se.sessions.remove(s.ID)
+	s.writeControl(sessionMessage{Type: "started", SessionID: s.ID})
+
+	log.Printf("shell session %s: started %q for %s", s.ID, s.Command, s.Remote)
+	reason, result := se.runSession(s)
+	log.Printf("shell session %s: ended (%s) exit_code=%d duration=%s",
+		s.ID, reason, *result.ExitCode, time.Since(s.StartedAt).Round(time.Millisecond))
+
+	// 会话的输出不记录到历史中
+	entry := newHistoryEntry(r.Context(), "session")
+	entry.ID = s.ID
+	entry.StartedAt = s.StartedAt
+	entry.setCommand(s.Command, s.cmd.Dir, s.env)
+	entry.DurationMs = time.Since(s.StartedAt).Milliseconds()
+	entry.ExitCode = *result.ExitCode
+	entry.Success = s.cmd.ProcessState != nil && s.cmd.ProcessState.Success()
+	entry.Signal = result.Signal
+	se.history.add(entry)
+
+	s.writeControl(result)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason), time.Now().Add(time.Second))
+}
+
+// startSession 读取start消息，校验命令并在PTY中启动
+func (se *ShellExecutor) startSession(s *shellSession, caller *core.Caller) error {
+	s.conn.SetReadDeadline(time.Now().Add(sessionStartTimeout))
+	var params map[string]interface{}
+	if err := s.conn.ReadJSON(&params); err != nil {
+		return fmt.Errorf("invalid start message: %v", err)
+	}
+	s.conn.SetReadDeadline(time.Time{})
+	if t, _ := params["type"].(string); t != "start" {
+		return fmt.Errorf("first message must be of type start")
+	}
+
+	// 服务器只按URL查询参数检查了session路由，start消息中的命令、目录、环境变量和密钥在这里按同样的规则检查
+	toolID := se.GetInfo().ID
+	if auth.RequiresApproval(se, "session", params) {
+		return fmt.Errorf("operation session of %s requires approval and cannot be used through this endpoint", toolID)
+	}
+	decision := policy.Check(policy.Input{Caller: caller, ToolID: toolID, Operation: "session", Params: params})
+	if !decision.Allowed {
+		return fmt.Errorf("denied by policy %s: %s", decision.Policy, decision.Reason)
+	}
+
+	cmd, env, err := se.prepareCommand(params, nil, caller)
+	if err != nil {
+		return err
+	}
+	if !contains(env.keys, "TERM") {
+		cmd.Env = append(cmd.Env, "TERM="+defaultSessionTerm)
+	}
+	s.Command = cmd.Args
+	s.cmd = cmd
+	s.env = env
+
+	if err := se.sessions.add(s); err != nil {
+		return err
+	}
+
+	setSessionLeader(cmd)
+	s.cleanup, err = sandbox.Wrap(cmd, config.Get().Tools.ShellExecutor.Sandbox)
+	if err != nil {
+		se.sessions.remove(s.ID)
+		return fmt.Errorf("failed to prepare sandbox: %v", err)
+	}
+
+	size := &pty.Winsize{Cols: 80, Rows: 24}
+	if cols, ok := params["cols"].(float64); ok && cols > 0 {
+		size.Cols = uint16(cols)
+	}
+	if rows, ok := params["rows"].(float64); ok && rows > 0 {
+		size.Rows = uint16(rows)
+	}
+
+	s.pty, err = pty.StartWithAttrs(cmd, size, cmd.SysProcAttr)
+	if err != nil {
+		s.cleanup()
+		se.sessions.remove(s.ID)
+		return fmt.Errorf("failed to start command: %v", err)
+	}
+	s.touch()
+	return nil
+}
+
+// runSession 在会话结束前转发输入输出，返回结束原因和exit消息
+func (se *ShellExecutor) runSession(s *shellSession) (string, sessionMessage) {
+	defer s.close()
+	defer s.cleanup()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.cmd.Wait()
+	}()
+
+	// 终端输出以二进制消息发送给客户端
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := s.pty.Read(buf)
+			if n > 0 {
+				s.touch()
+				if werr := s.writeMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// 客户端的输入和终端大小调整，二进制消息视为原始输入
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		for {
+			messageType, data, err := s.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				s.touch()
+				s.pty.Write(data)
+				continue
+			}
+
+			var msg sessionMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				s.writeControl(sessionMessage{Type: "error", Error: "invalid message: " + err.Error()})
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				s.touch()
+				s.pty.Write([]byte(msg.Data))
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
+					pty.Setsize(s.pty, &pty.Winsize{Cols: msg.Cols, Rows: msg.Rows})
+				}
+			default:
+				s.writeControl(sessionMessage{Type: "error", Error: "unsupported message type: " + msg.Type})
+			}
+		}
+	}()
+
+	idleTimeout := time.Duration(config.Get().Tools.ShellExecutor.Sessions.IdleTimeout) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = defaultSessionIdleTimeout * time.Second
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	reason := ""
+	exited := false
+	for reason == "" {
+		select {
+		case <-done:
+			reason, exited = "exited", true
+		case <-clientGone:
+			reason = "client_disconnected"
+		case <-s.closing:
+			reason = "server_shutdown"
+		case <-ticker.C:
+			if s.idleFor() >= idleTimeout {
+				reason = "idle_timeout"
+			}
+		}
+	}
+
+	// 未自行退出的命令先SIGTERM，宽限期后SIGKILL
+	signal := ""
+	if !exited {
+		signal, _ = terminateProcessGroup(s.cmd, false)
+		select {
+		case <-done:
+		case <-time.After(killGracePeriod()):
+			signal, _ = terminateProcessGroup(s.cmd, true)
+			// 进程处于不可中断状态时SIGKILL也可能无法立即结束它，不无限等待
+			select {
+			case <-done:
+			case <-time.After(killGracePeriod()):
+				log.Printf("shell session %s: process did not exit after SIGKILL", s.ID)
+			}
+		}
+	} else {
+		signal = exitSignal(s.cmd.ProcessState)
+	}
+	terminateProcessGroup(s.cmd, true)
+
+	// 命令退出后读取剩余输出，再关闭PTY
+	select {
+	case <-outputDone:
+	case <-time.After(time.Second):
+	}
+	s.pty.Close()
+	<-outputDone
+
+	exitCode := s.cmd.ProcessState.ExitCode()
+	return reason, sessionMessage{Type: "exit", SessionID: s.ID, ExitCode: &exitCode, Signal: signal, Reason: reason}
+}
+
+// Close 结束所有交互会话和后台进程，并关闭历史文件
+func (se *ShellExecutor) Close() {
+	se.sessions.closeAll()
+	se.processes.closeAll()
+	se.history.close()
+}
+
+// Routes 实现core.RouteProvider接口
+func (se *ShellExecutor) Routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"session": se.handleSession,
+	}
+}
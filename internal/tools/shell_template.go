@@ -0,0 +1,331 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gay/plugintools/internal/config"
+	"gay/plugintools/internal/core"
+)
+
+// placeholderPattern 模板命令中的 {{name}} 占位符
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// commandTemplate 已校验的命令模板
+type commandTemplate struct {
+	config.CommandTemplate
+	name     string
+	words    []string
+	patterns map[string]*regexp.Regexp
+}
+
+// compileTemplate 切分模板命令并校验参数定义
+func compileTemplate(name string, t config.CommandTemplate) (*commandTemplate, error) {
+	words, err := splitShellWords(t.Command)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: invalid command: %v", name, err)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("template %s: command is empty", name)
+	}
+	if placeholderPattern.MatchString(words[0]) {
+		return nil, fmt.Errorf("template %s: the executable cannot be a parameter", name)
+	}
+
+	ct := &commandTemplate{
+		CommandTemplate: t,
+		name:            name,
+		words:           words,
+		patterns:        make(map[string]*regexp.Regexp),
+	}
+	defined := make(map[string]bool)
+	for _, p := range t.Params {
+		if p.Name == "" || defined[p.Name] {
+			return nil, fmt.Errorf("template %s: parameter names must be unique and non-empty", name)
+		}
+		defined[p.Name] = true
+
+		switch p.Type {
+		case "", "string", "path", "integer", "number", "boolean":
+		default:
+			return nil, fmt.Errorf("template %s: unsupported type %s for parameter %s", name, p.Type, p.Name)
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("template %s: invalid pattern for parameter %s: %v", name, p.Name, err)
+			}
+			ct.patterns[p.Name] = re
+		}
+	}
+
+	for _, word := range words {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(word, -1) {
+			if !defined[m[1]] {
+				return nil, fmt.Errorf("template %s: undefined parameter %s", name, m[1])
+			}
+		}
+	}
+	return ct, nil
+}
+
+// expand 校验参数并展开为命令参数列表
+// 占位符在切分后的单个参数内替换，参数值不会再被切分或经过shell解释；
+// 未提供的可选参数所在的参数若只包含该占位符则被省略
+func (t *commandTemplate) expand(args map[string]interface{}) ([]string, error) {
+	values := make(map[string]string)
+	known := make(map[string]bool)
+	for _, p := range t.Params {
+		known[p.Name] = true
+		v, ok := args[p.Name]
+		if !ok || v == nil {
+			v = p.Default
+		}
+		if v == nil {
+			if p.Required {
+				return nil, fmt.Errorf("parameter %s is required", p.Name)
+			}
+			continue
+		}
+		value, err := t.formatValue(p, v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", p.Name, err)
+		}
+		values[p.Name] = value
+	}
+	for name := range args {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+
+	argv := make([]string, 0, len(t.words))
+	for _, word := range t.words {
+		if m := placeholderPattern.FindStringSubmatch(word); m != nil && m[0] == word {
+			if _, ok := values[m[1]]; !ok {
+				continue
+			}
+		}
+		argv = append(argv, placeholderPattern.ReplaceAllStringFunc(word, func(ph string) string {
+			return values[placeholderPattern.FindStringSubmatch(ph)[1]]
+		}))
+	}
+	return argv, nil
+}
+
+// formatValue 按参数类型校验值并转换为字符串
+func (t *commandTemplate) formatValue(p config.TemplateParam, v interface{}) (string, error) {
+	var value string
+	switch p.Type {
+	case "", "string", "path":
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("must be a string")
+		}
+		value = s
+	case "integer", "number":
+		f, ok := v.(float64)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("must be a number")
+		}
+		if p.Type == "integer" && f != math.Trunc(f) {
+			return "", fmt.Errorf("must be an integer")
+		}
+		if (p.Min != nil && f < *p.Min) || (p.Max != nil && f > *p.Max) {
+			return "", fmt.Errorf("value %v is out of range", f)
+		}
+		value = strconv.FormatFloat(f, 'f', -1, 64)
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return "", fmt.Errorf("must be a boolean")
+		}
+		value = strconv.FormatBool(b)
+	}
+
+	if strings.ContainsRune(value, 0) {
+		return "", fmt.Errorf("must not contain NUL characters")
+	}
+	if len(p.Enum) > 0 && !contains(p.Enum, value) {
+		return "", fmt.Errorf("value %q is not one of %s", value, strings.Join(p.Enum, ", "))
+	}
+	if re, ok := t.patterns[p.Name]; ok && !re.MatchString(value) {
+		return "", fmt.Errorf("value %q does not match the allowed pattern", value)
+	}
+	if strings.HasPrefix(value, "-") && !p.AllowDash && p.Type != "integer" && p.Type != "number" {
+		return "", fmt.Errorf("value %q must not start with '-'", value)
+	}
+	if p.Type == "path" {
+		path := value
+		if !filepath.IsAbs(path) && t.WorkingDir != "" {
+			path = filepath.Join(t.WorkingDir, path)
+		}
+		if !isAllowedPath(path) {
+			return "", fmt.Errorf("access to path %s is not allowed", value)
+		}
+	}
+	return value, nil
+}
+
+// paramSpecs 返回模板参数对应的参数规格
+func (t *commandTemplate) paramSpecs() []core.ParamSpec {
+	specs := make([]core.ParamSpec, 0, len(t.Params))
+	for _, p := range t.Params {
+		paramType := p.Type
+		switch paramType {
+		case "", "path":
+			paramType = "string"
+		}
+		description := p.Description
+		if len(p.Enum) > 0 {
+			description = fmt.Sprintf("%s (one of: %s)", description, strings.Join(p.Enum, ", "))
+		}
+		specs = append(specs, core.ParamSpec{
+			Name:        p.Name,
+			Type:        paramType,
+			Required:    p.Required && p.Default == nil,
+			Default:     p.Default,
+			Description: description,
+		})
+	}
+	return specs
+}
+
+// template 获取并校验配置中的命令模板
+func (se *ShellExecutor) template(name string) (*commandTemplate, error) {
+	t, ok := config.Get().Tools.ShellExecutor.Templates[name]
+	if !ok {
+		return nil, fmt.Errorf("template not found: %s", name)
+	}
+	return compileTemplate(name, t)
+}
+
+// runTemplate 展开命令模板并执行
+func (se *ShellExecutor) runTemplate(t *commandTemplate, args map[string]interface{}, entry *HistoryEntry) (interface{}, error) {
+	argv, err := t.expand(args)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %v", t.name, err)
+	}
+	entry.Template = t.name
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 30
+	}
+	params := map[string]interface{}{
+		"timeout":     float64(timeout),
+		"working_dir": t.WorkingDir,
+	}
+	return se.run(params, argv, entry)
+}
+
+// executeTemplate 处理template操作，template参数为模板名，args参数为模板参数
+func (se *ShellExecutor) executeTemplate(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	name, ok := params["template"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("template parameter is required")
+	}
+	t, err := se.template(name)
+	if err != nil {
+		return nil, err
+	}
+	args, _ := params["args"].(map[string]interface{})
+	entry := newHistoryEntry(ctx, "template")
+	unresolved, _ := entry.unresolved["args"].(map[string]interface{})
+	entry.setArgs(args, unresolved)
+	return se.runTemplate(t, args, entry)
+}
+
+// listTemplates 列出所有命令模板及其参数
+func (se *ShellExecutor) listTemplates() (interface{}, error) {
+	templates := config.Get().Tools.ShellExecutor.Templates
+	names := templateNames(templates)
+
+	result := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		t := templates[name]
+		ct, err := compileTemplate(name, t)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, map[string]interface{}{
+			"name":        name,
+			"description": t.Description,
+			"command":     t.Command,
+			"params":      ct.paramSpecs(),
+		})
+	}
+	return result, nil
+}
+
+// templateNames 返回按名称排序的模板名
+func templateNames(templates map[string]config.CommandTemplate) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TemplateTools 校验所有命令模板，并为设置了register的模板创建独立工具
+func (se *ShellExecutor) TemplateTools() ([]core.Tool, error) {
+	templates := config.Get().Tools.ShellExecutor.Templates
+	names := templateNames(templates)
+
+	var tools []core.Tool
+	for _, name := range names {
+		t, err := compileTemplate(name, templates[name])
+		if err != nil {
+			return nil, err
+		}
+		if t.Register {
+			tools = append(tools, &templateTool{executor: se, template: t})
+		}
+	}
+	return tools, nil
+}
+
+// templateTool 注册为独立工具的命令模板，参数即模板参数
+type templateTool struct {
+	executor *ShellExecutor
+	template *commandTemplate
+}
+
+// GetInfo 实现Tool接口
+func (tt *templateTool) GetInfo() core.ToolInfo {
+	description := tt.template.Description
+	if description == "" {
+		description = "Run " + tt.template.Command
+	}
+	return core.ToolInfo{
+		ID:          tt.template.name,
+		Name:        tt.template.name,
+		Description: description,
+		Version:     "1.0.0",
+		Category:    "Command",
+	}
+}
+
+// GetParams 实现Tool接口
+func (tt *templateTool) GetParams() []core.ParamSpec {
+	return tt.template.paramSpecs()
+}
+
+// Execute 实现Tool接口
+func (tt *templateTool) Execute(params map[string]interface{}) (interface{}, error) {
+	return tt.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext 实现core.ContextTool接口，调用方记录在执行历史中
+func (tt *templateTool) ExecuteContext(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	entry := newHistoryEntry(ctx, "template")
+	entry.setArgs(params, entry.unresolved)
+	return tt.executor.runTemplate(tt.template, params, entry)
+}